@@ -1,13 +1,20 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/titembaatar/sway.flem/internal/app"
 	"github.com/titembaatar/sway.flem/internal/config"
 	"github.com/titembaatar/sway.flem/internal/log"
+	"github.com/titembaatar/sway.flem/internal/sway"
 )
 
 const (
@@ -15,11 +22,52 @@ const (
 )
 
 type Flags struct {
-	ConfigFile  string
+	ConfigFiles listFlag
 	ShowVersion bool
 	Verbose     bool
 	Debug       bool
 	DryRun      bool
+	Timeout     time.Duration
+	OnFailure   string
+	Launch      string
+	Jobs        int
+	FocusMark   bool
+	Replace     bool
+	Report      string
+	Vars        varFlag
+	Strict      bool
+	Clean       bool
+}
+
+// Repeatable flag collecting its values in order
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// Repeatable '-var name=value' flag
+type varFlag map[string]string
+
+func (v *varFlag) String() string {
+	return fmt.Sprint(map[string]string(*v))
+}
+
+func (v *varFlag) Set(value string) error {
+	name, val, found := strings.Cut(value, "=")
+	if !found || name == "" {
+		return fmt.Errorf("expected name=value")
+	}
+	if *v == nil {
+		*v = make(varFlag)
+	}
+	(*v)[name] = val
+	return nil
 }
 
 func main() {
@@ -34,6 +82,8 @@ func main() {
 	switch command {
 	case "sway":
 		runSwayCommand(os.Args[cmdIndex+1:])
+	case "trust":
+		runTrustCommand(os.Args[cmdIndex+1:])
 	case "-h", "--help":
 		printUsage()
 		os.Exit(0)
@@ -49,6 +99,23 @@ func main() {
 
 // Handles the 'sway' subcommand
 func runSwayCommand(args []string) {
+	if len(args) > 0 {
+		switch args[0] {
+		case "toggle":
+			runToggleCommand(args[1:])
+			return
+		case "focus":
+			runFocusCommand(args[1:])
+			return
+		case "plan":
+			runPlanCommand(args[1:])
+			return
+		case "marks":
+			runMarksCommand(args[1:])
+			return
+		}
+	}
+
 	flags := parseFlags(args)
 
 	configureLogging(flags)
@@ -58,16 +125,35 @@ func runSwayCommand(args []string) {
 		os.Exit(0)
 	}
 
-	if flags.ConfigFile == "" {
-		log.Error("Config file must be specified")
-		fmt.Println("Error: Config file must be specified with -config flag")
-		fmt.Println("Run 'flem sway -h' for usage information")
+	onFailure, err := sway.ParseFailurePolicy(flags.OnFailure)
+	if err != nil {
+		log.Error("Invalid -on-failure value: %v", err)
+		fmt.Printf("Error: %v\n", err)
 		os.Exit(1)
 	}
 
+	launch, err := sway.ParseLaunchMode(flags.Launch)
+	if err != nil {
+		log.Error("Invalid -launch value: %v", err)
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if flags.Jobs < 1 {
+		log.Error("Invalid -jobs value: %d", flags.Jobs)
+		fmt.Println("Error: -jobs must be at least 1")
+		os.Exit(1)
+	}
+
+	if flags.Jobs > 1 && launch == sway.LaunchSequential {
+		log.Info("Using parallel launches, as required to set up several workspaces at once")
+		launch = sway.LaunchParallel
+	}
+
 	log.Info("Starting flem sway v%s", version)
 
-	cfg, err := config.LoadConfig(flags.ConfigFile)
+	discovery := configFiles(flags)
+	cfg, err := config.LoadConfig(discovery.Paths, loadOptions(flags))
 	if err != nil {
 		log.Fatal("Failed to load configuration: %v", err)
 	}
@@ -76,35 +162,299 @@ func runSwayCommand(args []string) {
 		log.Debug("Found workspace configuration: %s", name)
 	}
 
+	if discovery.Project {
+		requireTrust(cfg, discovery.Paths[0], flags.DryRun)
+	}
+
 	if flags.DryRun {
+		cfg, err := app.ResolveGuards(cfg)
+		if err != nil {
+			log.Fatal("Failed to apply when guards: %v", err)
+		}
+		if err := app.CheckOutputs(context.Background(), cfg); err != nil {
+			log.Warn("Could not check workspace outputs: %v", err)
+		}
 		log.Info("Dry run completed successfully. Configuration is valid.")
 		os.Exit(0)
 	}
 
-	if err := app.Setup(cfg); err != nil {
-		log.Fatal("Failed to setup environment: %v", err)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Restore default signal handling once the first signal is received, so
+	// that a second Ctrl-C kills flem immediately
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	if flags.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, flags.Timeout)
+		defer cancel()
+	}
+
+	opts := sway.DefaultSetupOptions()
+	opts.OnFailure = onFailure
+	opts.Launch = launch
+	opts.Jobs = flags.Jobs
+	opts.AllowFocusMark = flags.FocusMark
+	opts.ReplaceMarks = flags.Replace
+	opts.ReportPath = flags.Report
+
+	report, err := app.Setup(ctx, cfg, opts)
+	if report != nil && flags.Report != "" {
+		if writeErr := report.WriteFile(flags.Report); writeErr != nil {
+			log.Warn("Failed to write report: %v", writeErr)
+		}
+	}
+
+	if err != nil {
+		if report != nil {
+			report.Print(os.Stderr)
+		}
+
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			log.Error("Setup timed out after %s", flags.Timeout)
+		case errors.Is(err, context.Canceled):
+			log.Error("Setup interrupted")
+		default:
+			log.Error("Failed to setup environment: %v", err)
+		}
+		os.Exit(app.ExitStatus(err))
+	}
+
+	if log.GetLevel() <= log.LogLevelInfo {
+		report.Print(os.Stderr)
 	}
 
 	log.Info("Sway environment has been successfully configured")
 }
 
+// Handles the 'sway toggle' subcommand
+func runToggleCommand(args []string) {
+	flags := &Flags{}
+
+	flagSet := flag.NewFlagSet("sway toggle", flag.ExitOnError)
+	flagSet.BoolVar(&flags.Verbose, "verbose", false, "Enable verbose logging")
+	flagSet.BoolVar(&flags.Debug, "debug", false, "Enable debug mode with extra logging")
+	flagSet.Parse(args)
+
+	configureLogging(flags)
+
+	if flagSet.NArg() != 1 {
+		fmt.Println("Error: toggle takes the name of a scratchpad application")
+		fmt.Println("Run 'flem -h' for usage information")
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := app.ToggleScratchpad(ctx, flagSet.Arg(0)); err != nil {
+		log.Fatal("Failed to toggle scratchpad application: %v", err)
+	}
+}
+
+// Handles the 'sway focus' subcommand
+func runFocusCommand(args []string) {
+	flags := &Flags{}
+
+	flagSet := flag.NewFlagSet("sway focus", flag.ExitOnError)
+	flagSet.BoolVar(&flags.Verbose, "verbose", false, "Enable verbose logging")
+	flagSet.BoolVar(&flags.Debug, "debug", false, "Enable debug mode with extra logging")
+	flagSet.Parse(args)
+
+	configureLogging(flags)
+
+	if flagSet.NArg() != 1 {
+		fmt.Println("Error: focus takes the id of a container")
+		fmt.Println("Run 'flem -h' for usage information")
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := app.FocusContainer(ctx, flagSet.Arg(0)); err != nil {
+		log.Fatal("Failed to focus container: %v", err)
+	}
+}
+
+// Handles the 'sway plan' subcommand
+func runPlanCommand(args []string) {
+	flags := &Flags{}
+
+	flagSet := flag.NewFlagSet("sway plan", flag.ExitOnError)
+	flagSet.Var(&flags.ConfigFiles, "config", "Path to configuration file, '-' for stdin, later ones merged over earlier ones (repeatable)")
+	flagSet.BoolVar(&flags.Verbose, "verbose", false, "Enable verbose logging")
+	flagSet.BoolVar(&flags.Debug, "debug", false, "Enable debug mode with extra logging")
+	flagSet.Var(&flags.Vars, "var", "Set a configuration variable, as name=value (repeatable)")
+	flagSet.BoolVar(&flags.Strict, "strict", false, "Fail on unknown configuration fields instead of warning about them")
+	flagSet.Parse(args)
+
+	configureLogging(flags)
+
+	cfg, err := config.LoadConfig(configFiles(flags).Paths, loadOptions(flags))
+	if err != nil {
+		log.Fatal("Failed to load configuration: %v", err)
+	}
+
+	if err := app.Plan(context.Background(), cfg, os.Stdout); err != nil {
+		log.Fatal("Failed to plan setup: %v", err)
+	}
+}
+
+// Handles the 'sway marks' subcommand
+func runMarksCommand(args []string) {
+	flags := &Flags{}
+
+	flagSet := flag.NewFlagSet("sway marks", flag.ExitOnError)
+	flagSet.Var(&flags.ConfigFiles, "config", "Path to configuration file, '-' for stdin, later ones merged over earlier ones (repeatable)")
+	flagSet.BoolVar(&flags.Clean, "clean", false, "Remove the marks whose windows are gone or no longer match the configuration")
+	flagSet.BoolVar(&flags.Verbose, "verbose", false, "Enable verbose logging")
+	flagSet.BoolVar(&flags.Debug, "debug", false, "Enable debug mode with extra logging")
+	flagSet.Var(&flags.Vars, "var", "Set a configuration variable, as name=value (repeatable)")
+	flagSet.BoolVar(&flags.Strict, "strict", false, "Fail on unknown configuration fields instead of warning about them")
+	flagSet.Parse(args)
+
+	configureLogging(flags)
+
+	cfg, err := config.LoadConfig(configFiles(flags).Paths, loadOptions(flags))
+	if err != nil {
+		log.Fatal("Failed to load configuration: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := app.Marks(ctx, cfg, flags.Clean, os.Stdout); err != nil {
+		log.Fatal("Failed to check marks: %v", err)
+	}
+}
+
+// Handles the 'trust' command
+func runTrustCommand(args []string) {
+	flags := &Flags{}
+
+	flagSet := flag.NewFlagSet("trust", flag.ExitOnError)
+	flagSet.BoolVar(&flags.Verbose, "verbose", false, "Enable verbose logging")
+	flagSet.BoolVar(&flags.Debug, "debug", false, "Enable debug mode with extra logging")
+	flagSet.BoolVar(&flags.Strict, "strict", false, "Fail on unknown configuration fields instead of warning about them")
+	flagSet.Parse(args)
+
+	configureLogging(flags)
+
+	if flagSet.NArg() != 1 || flagSet.Arg(0) == config.StdinPath {
+		fmt.Println("Error: trust takes the path of a configuration file")
+		fmt.Println("Run 'flem -h' for usage information")
+		os.Exit(1)
+	}
+	path := flagSet.Arg(0)
+
+	cfg, err := config.LoadConfig([]string{path}, loadOptions(flags))
+	if err != nil {
+		log.Fatal("Failed to load configuration: %v", err)
+	}
+
+	store, err := config.LoadTrustStore()
+	if err != nil {
+		log.Fatal("Failed to load trust store: %v", err)
+	}
+	if err := store.Trust(cfg, path); err != nil {
+		log.Fatal("Failed to trust configuration: %v", err)
+	}
+
+	fmt.Printf("Trusted %s, allowing it to run:\n", path)
+	printCommands(cfg.Commands())
+}
+
+// Returns the configuration files given with -config, or those discovered
+func configFiles(flags *Flags) config.Discovery {
+	if len(flags.ConfigFiles) > 0 {
+		return config.Discovery{Paths: flags.ConfigFiles}
+	}
+
+	discovery, err := config.DiscoverConfig()
+	if err != nil {
+		log.Error("No configuration: %v", err)
+		fmt.Printf("Error: %v\n", err)
+		fmt.Println("Run 'flem -h' for usage information")
+		os.Exit(1)
+	}
+	return discovery
+}
+
+// Exits unless a project configuration running commands is trusted; a dry
+// run, which runs none, only warns
+func requireTrust(cfg *config.Config, path string, dryRun bool) {
+	store, err := config.LoadTrustStore()
+	if err != nil {
+		log.Fatal("Failed to load trust store: %v", err)
+	}
+
+	err = store.Check(cfg, path)
+	var untrusted *config.UntrustedError
+	switch {
+	case err == nil:
+		return
+	case !errors.As(err, &untrusted):
+		log.Fatal("Failed to check trust: %v", err)
+	case dryRun:
+		log.Warn("%v; run 'flem trust %s' before setting it up", err, path)
+		return
+	}
+
+	log.Error("Refusing to run project configuration: %v", err)
+	fmt.Printf("Error: %v\n", err)
+	fmt.Println("It runs the following commands:")
+	printCommands(untrusted.Commands)
+	fmt.Printf("Run 'flem trust %s' to allow them\n", path)
+	os.Exit(1)
+}
+
+// Prints the commands of a configuration, one per line
+func printCommands(commands []config.ConfigCommand) {
+	if len(commands) == 0 {
+		fmt.Println("  (no commands)")
+	}
+	for _, command := range commands {
+		fmt.Printf("  %s\n", command)
+	}
+}
+
 // Parses command line flags and returns the parsed values
 func parseFlags(args []string) *Flags {
 	flags := &Flags{}
 
 	flagSet := flag.NewFlagSet("sway", flag.ExitOnError)
 
-	flagSet.StringVar(&flags.ConfigFile, "config", "", "Path to configuration file")
+	flagSet.Var(&flags.ConfigFiles, "config", "Path to configuration file, '-' for stdin, later ones merged over earlier ones (repeatable)")
 	flagSet.BoolVar(&flags.ShowVersion, "version", false, "Show version information")
 	flagSet.BoolVar(&flags.Verbose, "verbose", false, "Enable verbose logging")
 	flagSet.BoolVar(&flags.Debug, "debug", false, "Enable debug mode with extra logging")
 	flagSet.BoolVar(&flags.DryRun, "dry-run", false, "Validate configuration without making changes")
+	flagSet.DurationVar(&flags.Timeout, "timeout", 0, "Abort the setup after the given duration (e.g. 30s, 2m)")
+	flagSet.StringVar(&flags.Launch, "launch", string(sway.LaunchSequential), "How applications are launched: sequential or parallel")
+	flagSet.IntVar(&flags.Jobs, "jobs", 1, "Number of workspaces to set up at the same time")
+	flagSet.BoolVar(&flags.FocusMark, "allow-focus-mark", false, "Mark the focused window when an application window cannot be identified")
+	flagSet.BoolVar(&flags.Replace, "replace-marks", false, "Move marks already set on other containers to the new windows instead of failing")
+	flagSet.StringVar(&flags.Report, "report", "", "Write the setup report as JSON to the given file")
+	flagSet.StringVar(&flags.OnFailure, "on-failure", string(sway.FailureKeep), "What to do when a workspace fails: rollback, keep or abort")
+	flagSet.Var(&flags.Vars, "var", "Set a configuration variable, as name=value (repeatable)")
+	flagSet.BoolVar(&flags.Strict, "strict", false, "Fail on unknown configuration fields instead of warning about them")
 
 	flagSet.Parse(args)
 
 	return flags
 }
 
+// Options of configuration loading given by flags
+func loadOptions(flags *Flags) config.LoadOptions {
+	return config.LoadOptions{Vars: flags.Vars, Strict: flags.Strict}
+}
+
 // Sets up the logging level based on flags
 func configureLogging(flags *Flags) {
 	if flags.Debug {
@@ -120,17 +470,42 @@ func printUsage() {
 	fmt.Println("Usage: flem [options] <command>")
 	fmt.Println("\nCommands:")
 	fmt.Println("  sway                  Configure Sway workspaces")
+	fmt.Println("  sway toggle <name>    Show or hide a scratchpad application")
+	fmt.Println("  sway focus <id>       Focus the container with the given id")
+	fmt.Println("  sway plan             Show the workspace variants selected for the connected outputs")
+	fmt.Println("  sway marks [-clean]   List the marks set by flem, removing stale ones with -clean")
+	fmt.Println("  trust <file>          Allow a project configuration to run its commands")
 	fmt.Println("\nGlobal Options:")
 	fmt.Println("  -h, --help            Show this help message")
 	fmt.Println("  -v, --version         Show version information")
 	fmt.Println("\nSway Command Options:")
-	fmt.Println("  -config <file>        Path to configuration file (required)")
+	fmt.Println("  -config <file>        Path to configuration file, '-' for stdin (repeatable: later files override earlier ones)")
+	fmt.Println("                        Defaults to $FLEM_CONFIG, then .flem.yml in the current directory or above,")
+	fmt.Println("                        then $XDG_CONFIG_HOME/flem/config.{yml,yaml,json,toml}")
 	fmt.Println("  -version              Show version information")
 	fmt.Println("  -verbose              Enable verbose logging")
 	fmt.Println("  -debug                Enable debug mode with extra logging")
 	fmt.Println("  -dry-run              Validate configuration without making changes")
+	fmt.Println("  -timeout <duration>   Abort the setup after the given duration (e.g. 30s)")
+	fmt.Println("  -launch <mode>        Launch applications one by one (sequential) or all at once (parallel)")
+	fmt.Println("  -jobs <n>             Number of workspaces to set up at the same time (default 1)")
+	fmt.Println("  -allow-focus-mark     Mark the focused window when an application window cannot be identified")
+	fmt.Println("  -replace-marks        Move marks already set on other containers instead of failing")
+	fmt.Println("  -on-failure <policy>  What to do when a workspace fails: rollback, keep (default) or abort")
+	fmt.Println("  -report <file>        Write the setup report as JSON to the given file")
+	fmt.Println("  -var <name>=<value>   Set a configuration variable, overriding vars and FLEM_VAR_<name> (repeatable)")
+	fmt.Println("  -strict               Fail on unknown configuration fields instead of warning about them")
 	fmt.Println("\nExamples:")
+	fmt.Println("  flem sway")
 	fmt.Println("  flem sway -config ~/.config/sway/config.yml")
 	fmt.Println("  flem sway -config ~/.config/sway/config.yml -verbose")
 	fmt.Println("  flem sway -config ~/.config/sway/config.yml -dry-run")
+	fmt.Println("  flem sway -config ~/.config/sway/config.yml -var term=alacritty")
+	fmt.Println("  flem sway -config ~/team/base.yml -config ~/.config/flem/laptop.yml")
+	fmt.Println("  generate-config | flem sway -config -")
+	fmt.Println("  flem trust .flem.yml")
+	fmt.Println("  flem sway toggle notes")
+	fmt.Println("  flem sway focus editor")
+	fmt.Println("  flem sway plan -config ~/.config/sway/config.yml")
+	fmt.Println("  flem sway marks -clean")
 }
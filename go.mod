@@ -2,4 +2,7 @@ module github.com/titembaatar/sway.flem
 
 go 1.24.1
 
-require gopkg.in/yaml.v3 v3.0.1 // indirect
+require (
+	github.com/BurntSushi/toml v1.6.0
+	gopkg.in/yaml.v3 v3.0.1
+)
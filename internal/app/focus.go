@@ -0,0 +1,29 @@
+package app
+
+import (
+	"context"
+
+	"github.com/titembaatar/sway.flem/internal/log"
+	"github.com/titembaatar/sway.flem/internal/sway"
+)
+
+// Focuses a container launched by a setup, by its id
+func FocusContainer(ctx context.Context, id string) error {
+	log.SetComponent(log.ComponentApp)
+
+	op := log.Operation("container focus")
+	op.Begin()
+
+	if err := validateEnvironment(ctx); err != nil {
+		op.EndWithError(err)
+		return err
+	}
+
+	if err := sway.FocusContainer(ctx, id); err != nil {
+		op.EndWithError(err)
+		return err
+	}
+
+	op.End()
+	return nil
+}
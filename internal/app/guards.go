@@ -0,0 +1,22 @@
+package app
+
+import (
+	"time"
+
+	"github.com/titembaatar/sway.flem/internal/config"
+	"github.com/titembaatar/sway.flem/internal/log"
+)
+
+// Removes the parts of the configuration whose when guard does not hold on
+// this machine
+func ResolveGuards(cfg *config.Config) (*config.Config, error) {
+	resolved, excluded, err := config.ApplyGuards(cfg, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, exclusion := range excluded {
+		log.Info("Skipping %s", exclusion)
+	}
+	return resolved, nil
+}
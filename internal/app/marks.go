@@ -0,0 +1,66 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/titembaatar/sway.flem/internal/config"
+	"github.com/titembaatar/sway.flem/internal/log"
+	"github.com/titembaatar/sway.flem/internal/sway"
+)
+
+// Writes the marks set by flem and whether they still match the
+// configuration, removing the stale ones when clean is set
+func Marks(ctx context.Context, cfg *config.Config, clean bool, w io.Writer) error {
+	log.SetComponent(log.ComponentApp)
+
+	op := log.Operation("marks check")
+	op.Begin()
+
+	if err := validateEnvironment(ctx); err != nil {
+		op.EndWithError(err)
+		return err
+	}
+
+	cfg, err := ResolveGuards(cfg)
+	if err != nil {
+		op.EndWithError(err)
+		return err
+	}
+
+	marks, err := sway.CheckMarks(ctx, cfg)
+	if err != nil {
+		op.EndWithError(err)
+		return err
+	}
+
+	var stale []sway.MarkStatus
+	for _, mark := range marks {
+		line := fmt.Sprintf("  %s  container %d on %s", mark.Mark, mark.ConID, mark.Workspace)
+		if mark.Name != "" {
+			line += fmt.Sprintf(" (%s)", mark.Name)
+		}
+		if mark.Stale != "" {
+			line += "  stale: " + mark.Stale
+			stale = append(stale, mark)
+		}
+		fmt.Fprintln(w, line)
+	}
+
+	switch {
+	case len(marks) == 0:
+		fmt.Fprintln(w, "No marks set by flem")
+	case !clean:
+		fmt.Fprintf(w, "%d marks, %d stale\n", len(marks), len(stale))
+	default:
+		if err := sway.RemoveMarks(ctx, stale); err != nil {
+			op.EndWithError(err)
+			return err
+		}
+		fmt.Fprintf(w, "Removed %d stale marks\n", len(stale))
+	}
+
+	op.End()
+	return nil
+}
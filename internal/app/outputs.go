@@ -0,0 +1,65 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+
+	"github.com/titembaatar/sway.flem/internal/config"
+	"github.com/titembaatar/sway.flem/internal/log"
+	"github.com/titembaatar/sway.flem/internal/sway"
+)
+
+// Checks the outputs of the workspaces against the connected outputs
+//
+// Missing outputs are only reported, as the setup falls back to the next
+// preference or leaves the workspace where sway puts it.
+func CheckOutputs(ctx context.Context, config *config.Config) error {
+	log.SetComponent(log.ComponentApp)
+
+	var assigned []string
+	for _, name := range sway.WorkspaceOrder(config) {
+		if len(config.Workspaces[name].Output) > 0 {
+			assigned = append(assigned, name)
+		}
+	}
+	if len(assigned) == 0 {
+		return nil
+	}
+
+	// Dry runs may happen outside of sway, where there is nothing to check
+	if _, err := exec.LookPath("swaymsg"); err != nil {
+		return fmt.Errorf("swaymsg not found: %w", err)
+	}
+
+	op := log.Operation("output check")
+	op.Begin()
+
+	outputs, err := sway.GetOutputs(ctx)
+	if err != nil {
+		op.EndWithError(err)
+		return err
+	}
+
+	for _, name := range assigned {
+		preferences := config.Workspaces[name].Output
+		output, index := sway.ResolveOutput(preferences, outputs)
+
+		missing := preferences
+		if index >= 0 {
+			missing = preferences[:index]
+		}
+		for _, match := range missing {
+			log.Warn("Workspace %s: output %s is not connected", name, match)
+		}
+
+		if index < 0 {
+			log.Warn("Workspace %s: no output connected, sway will place it", name)
+			continue
+		}
+		log.Info("Workspace %s will be on output %s", name, output.Name)
+	}
+
+	op.End()
+	return nil
+}
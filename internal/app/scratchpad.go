@@ -0,0 +1,29 @@
+package app
+
+import (
+	"context"
+
+	"github.com/titembaatar/sway.flem/internal/log"
+	"github.com/titembaatar/sway.flem/internal/sway"
+)
+
+// Shows or hides a scratchpad application launched by a setup
+func ToggleScratchpad(ctx context.Context, name string) error {
+	log.SetComponent(log.ComponentApp)
+
+	op := log.Operation("scratchpad toggle")
+	op.Begin()
+
+	if err := validateEnvironment(ctx); err != nil {
+		op.EndWithError(err)
+		return err
+	}
+
+	if err := sway.ToggleScratchpad(ctx, name); err != nil {
+		op.EndWithError(err)
+		return err
+	}
+
+	op.End()
+	return nil
+}
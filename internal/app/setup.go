@@ -1,8 +1,13 @@
 package app
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"time"
 
@@ -12,38 +17,175 @@ import (
 )
 
 // Initializes and configures the Sway environment based on the configuration
-func Setup(config *config.Config) error {
+//
+// The report describes what was set up so far; it is nil only when the setup
+// could not start at all. Top-level hooks run around the whole setup, with the
+// report written to opts.ReportPath before after_all and on_failure hooks.
+func Setup(ctx context.Context, config *config.Config, opts sway.SetupOptions) (*sway.SetupReport, error) {
 	log.SetComponent(log.ComponentApp)
 
 	op := log.Operation("environment setup")
 	op.Begin()
 
-	if err := validateEnvironment(); err != nil {
+	if err := validateEnvironment(ctx); err != nil {
 		op.EndWithError(err)
-		return err
+		return nil, err
 	}
 
-	if err := executeSetup(config); err != nil {
+	config, err := ResolveGuards(config)
+	if err == nil {
+		config, err = resolveVariants(ctx, config)
+	}
+	if err != nil {
 		op.EndWithError(err)
-		return err
+		return nil, err
+	}
+
+	if opts.ReportPath == "" && hasHooks(config) {
+		opts.ReportPath, err = defaultReportPath()
+		if err != nil {
+			op.EndWithError(err)
+			return nil, err
+		}
+	}
+
+	// Reported under their name in sway, in setup order
+	order := sway.WorkspaceOrder(config)
+	names := make([]string, len(order))
+	for i, key := range order {
+		names[i] = config.Workspaces[key].SwayName(key)
 	}
+	report := sway.NewSetupReport(names)
+	// The report is not written yet, so it is not passed to before_all hooks
+	results, err := sway.RunHooks(ctx, sway.HookBeforeAll, config.Hooks.BeforeAll, nil)
+	report.Hooks = append(report.Hooks, results...)
 
-	if err := focusRequestedWorkspaces(config); err != nil {
-		log.Warn("Some workspace focusing operations failed: %v", err)
+	if err == nil {
+		err = executeSetup(ctx, config, report, opts)
+	} else {
+		report.Finish(err)
+	}
+
+	if err == nil {
+		if focusErr := focusRequestedWorkspaces(ctx, config); focusErr != nil {
+			if ctx.Err() != nil {
+				err = focusErr
+			} else {
+				log.Warn("Some workspace focusing operations failed: %v", focusErr)
+			}
+		}
+	}
+
+	runFinalHooks(ctx, config, report, opts, err)
+
+	if err != nil {
+		op.EndWithError(err)
+		return report, err
 	}
 
 	op.End()
-	return nil
+	return report, nil
+}
+
+// Exit status of flem for the result of a setup
+func ExitStatus(err error) int {
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, context.Canceled):
+		return 130
+	default:
+		return 1
+	}
+}
+
+// Writes the report and runs the after_all hooks, then the on_failure ones if
+// the setup or any workspace failed
+func runFinalHooks(ctx context.Context, config *config.Config, report *sway.SetupReport, opts sway.SetupOptions, setupErr error) {
+	failed := setupErr != nil || report.Failed()
+	if len(config.Hooks.AfterAll) == 0 && (!failed || len(config.Hooks.OnFailure) == 0) {
+		return
+	}
+
+	status := ExitStatus(setupErr)
+	if status == 0 && failed {
+		status = 1
+	}
+
+	env := []string{
+		"FLEM_REPORT=" + opts.ReportPath,
+		fmt.Sprintf("FLEM_STATUS=%d", status),
+	}
+
+	if err := report.WriteFile(opts.ReportPath); err != nil {
+		log.Warn("Failed to write report for hooks: %v", err)
+	}
+
+	// Final hooks also run when the setup was interrupted
+	hookCtx := context.WithoutCancel(ctx)
+
+	results, err := sway.RunHooks(hookCtx, sway.HookAfterAll, config.Hooks.AfterAll, env)
+	report.Hooks = append(report.Hooks, results...)
+	if err != nil {
+		log.Warn("Some after_all hooks failed: %v", err)
+	}
+
+	if failed {
+		results, err := sway.RunHooks(hookCtx, sway.HookOnFailure, config.Hooks.OnFailure, env)
+		report.Hooks = append(report.Hooks, results...)
+		if err != nil {
+			log.Warn("Some on_failure hooks failed: %v", err)
+		}
+	}
+}
+
+// Whether the configuration defines any hook
+func hasHooks(config *config.Config) bool {
+	hooks := []any{config.Hooks}
+	for _, workspace := range config.Workspaces {
+		hooks = append(hooks, workspace.Hooks)
+	}
+
+	for _, h := range hooks {
+		if !reflect.ValueOf(h).IsZero() {
+			return true
+		}
+	}
+	return false
+}
+
+// Report location used for hooks when none was given
+//
+// The report goes to a directory of the user, $XDG_RUNTIME_DIR, then
+// $XDG_STATE_HOME or ~/.local/state, and only without a home to a new
+// private directory in the temporary directory, never to a fixed path that
+// other users could create first.
+func defaultReportPath() (string, error) {
+	for _, dir := range []string{os.Getenv("XDG_RUNTIME_DIR"), os.Getenv("XDG_STATE_HOME")} {
+		if dir != "" {
+			return filepath.Join(dir, "flem", "report.json"), nil
+		}
+	}
+
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".local", "state", "flem", "report.json"), nil
+	}
+
+	dir, err := os.MkdirTemp("", "flem-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create report directory: %w", err)
+	}
+	return filepath.Join(dir, "report.json"), nil
 }
 
 // Verifies that all required external dependencies are available
-func validateEnvironment() error {
+func validateEnvironment(ctx context.Context) error {
 	envOp := log.Operation("dependency validation")
 	envOp.Begin()
 
 	log.Debug("Checking for required dependencies")
 
-	if err := checkCommand("swaymsg"); err != nil {
+	if err := checkCommand(ctx, "swaymsg"); err != nil {
 		envOp.EndWithError(err)
 		return fmt.Errorf("swaymsg not found: %w", err)
 	}
@@ -54,7 +196,7 @@ func validateEnvironment() error {
 }
 
 // Execute the environment setup
-func executeSetup(config *config.Config) error {
+func executeSetup(ctx context.Context, config *config.Config, report *sway.SetupReport, opts sway.SetupOptions) error {
 	setupOp := log.Operation("sway configuration")
 	setupOp.Begin()
 
@@ -63,7 +205,7 @@ func executeSetup(config *config.Config) error {
 
 	startTime := time.Now()
 
-	if err := sway.SetupEnvironment(config); err != nil {
+	if err := sway.SetupEnvironment(ctx, config, report, opts); err != nil {
 		setupOp.EndWithError(err)
 		return fmt.Errorf("failed to setup environment: %w", err)
 	}
@@ -75,8 +217,8 @@ func executeSetup(config *config.Config) error {
 	return nil
 }
 
-// Focus on workspaces specified in the config
-func focusRequestedWorkspaces(config *config.Config) error {
+// Focus on the workspaces and containers specified in the config
+func focusRequestedWorkspaces(ctx context.Context, config *config.Config) error {
 	if len(config.Focus) == 0 {
 		return nil
 	}
@@ -84,8 +226,18 @@ func focusRequestedWorkspaces(config *config.Config) error {
 	focusOp := log.Operation("workspace focusing")
 	focusOp.Begin()
 
-	log.Info("Focusing on %d specified workspaces: %v", len(config.Focus), config.Focus)
-	err := sway.FocusWorkspaces(config.Focus)
+	targets := make([]sway.FocusTarget, 0, len(config.Focus))
+	for _, entry := range config.Focus {
+		if config.IsFocusID(entry) {
+			targets = append(targets, sway.FocusTarget{ID: entry})
+		} else {
+			workspace := config.Workspaces[entry]
+			targets = append(targets, sway.FocusTarget{Workspace: workspace.SwayName(entry), Number: workspace.Number})
+		}
+	}
+
+	log.Info("Focusing on %d specified targets: %v", len(targets), config.Focus)
+	err := sway.Focus(ctx, targets)
 
 	if err != nil {
 		focusOp.EndWithError(err)
@@ -97,10 +249,10 @@ func focusRequestedWorkspaces(config *config.Config) error {
 }
 
 // Checks if a command is available in the PATH
-func checkCommand(command string) error {
+func checkCommand(ctx context.Context, command string) error {
 	log.Debug("Checking if %s is available", command)
 
-	cmd := exec.Command(command, "-v")
+	cmd := exec.CommandContext(ctx, command, "-v")
 	output, err := cmd.CombinedOutput()
 
 	if err != nil {
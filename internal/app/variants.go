@@ -0,0 +1,117 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/titembaatar/sway.flem/internal/config"
+	"github.com/titembaatar/sway.flem/internal/log"
+	"github.com/titembaatar/sway.flem/internal/sway"
+)
+
+// Replaces the workspaces with variants by the variant matching the connected
+// outputs
+func resolveVariants(ctx context.Context, cfg *config.Config) (*config.Config, error) {
+	if !cfg.HasVariants() {
+		return cfg, nil
+	}
+
+	outputs, err := sway.GetOutputs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get outputs to select variants: %w", err)
+	}
+
+	choices := sway.SelectVariants(cfg, outputs)
+	for _, choice := range choices {
+		for _, reason := range choice.Reasons {
+			log.Debug("Workspace %s: %s", choice.Workspace, reason)
+		}
+		log.Info("Workspace %s: %s", choice.Workspace, choice.Reasons[len(choice.Reasons)-1])
+	}
+
+	return config.ApplyVariants(cfg, sway.VariantIndexes(choices))
+}
+
+// Writes the connected outputs, the variant and output the setup would use
+// for each workspace, and what when guards leave out
+func Plan(ctx context.Context, cfg *config.Config, w io.Writer) error {
+	log.SetComponent(log.ComponentApp)
+
+	if err := validateEnvironment(ctx); err != nil {
+		return err
+	}
+
+	outputs, err := sway.GetOutputs(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get outputs: %w", err)
+	}
+
+	fmt.Fprintln(w, "Outputs:")
+	for _, output := range outputs {
+		if !output.Active {
+			continue
+		}
+		line := fmt.Sprintf("  %s  %s  %s  scale %g", output.Name, output.Resolution(), output.Orientation(), output.Scale)
+		if identity := strings.TrimSpace(strings.Join([]string{output.Make, output.Model, output.Serial}, " ")); identity != "" {
+			line += "  " + identity
+		}
+		fmt.Fprintln(w, line)
+	}
+
+	cfg, excluded, err := config.ApplyGuards(cfg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	choices := sway.SelectVariants(cfg, outputs)
+	resolved, err := config.ApplyVariants(cfg, sway.VariantIndexes(choices))
+	if err != nil {
+		return err
+	}
+
+	reasons := make(map[string][]string)
+	selected := make(map[string]int)
+	for _, choice := range choices {
+		reasons[choice.Workspace] = choice.Reasons
+		selected[choice.Workspace] = choice.Index + 1
+	}
+
+	fmt.Fprintln(w, "\nWorkspaces:")
+	for _, name := range sway.WorkspaceOrder(resolved) {
+		workspace := resolved.Workspaces[name]
+
+		variant := "default"
+		if selected[name] > 0 {
+			variant = fmt.Sprintf("variant %d", selected[name])
+		}
+
+		line := fmt.Sprintf("  %s  %s  layout=%s containers=%d", name, variant, workspace.Layout, len(workspace.Containers))
+		if swayName := workspace.SwayName(name); swayName != name {
+			line += fmt.Sprintf(" name='%s'", swayName)
+		}
+		if len(workspace.Output) > 0 {
+			output, index := sway.ResolveOutput(workspace.Output, outputs)
+			if index < 0 {
+				output.Name = "none"
+			}
+			line += " output=" + output.Name
+		}
+		fmt.Fprintln(w, line)
+
+		for _, reason := range reasons[name] {
+			fmt.Fprintf(w, "      %s\n", reason)
+		}
+	}
+
+	if len(excluded) > 0 {
+		fmt.Fprintln(w, "\nExcluded:")
+		for _, exclusion := range excluded {
+			fmt.Fprintf(w, "  %s\n", exclusion)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Application of the apps catalog, referenced by name from containers
+type AppSpec struct {
+	Cmd     string            `yaml:"cmd" json:"cmd"`
+	Match   Match             `yaml:"match" json:"match"`
+	Delay   int64             `yaml:"delay" json:"delay"`
+	Timeout int64             `yaml:"timeout" json:"timeout"`
+	Env     map[string]string `yaml:"env" json:"env"`
+	Post    []string          `yaml:"post" json:"post"`
+}
+
+// Returns the container with the fields it leaves empty taken from the
+// catalog application
+//
+// Environment variables are merged, those of the container winning.
+func (c Container) WithApp(spec AppSpec) Container {
+	if c.Cmd == "" {
+		c.Cmd = spec.Cmd
+	}
+	if c.Match.IsEmpty() {
+		c.Match = spec.Match
+	}
+	if c.Delay == 0 {
+		c.Delay = spec.Delay
+	}
+	if c.Timeout == 0 {
+		c.Timeout = spec.Timeout
+	}
+	// An empty list clears the post actions of the catalog
+	if c.Post == nil {
+		c.Post = spec.Post
+	}
+
+	if len(spec.Env) > 0 {
+		env := maps.Clone(spec.Env)
+		maps.Copy(env, c.Env)
+		c.Env = env
+	}
+
+	return c
+}
+
+// Environment of the container as 'NAME=value' entries, sorted by name
+func (c Container) Environ() []string {
+	var env []string
+	for _, name := range slices.Sorted(maps.Keys(c.Env)) {
+		env = append(env, name+"="+c.Env[name])
+	}
+	return env
+}
+
+// Checks the catalog and resolves the containers referring to it, in
+// workspaces, variants and the scratchpad
+func resolveApps(config *Config) error {
+	for _, name := range slices.Sorted(maps.Keys(config.Apps)) {
+		spec := config.Apps[name]
+		context := fmt.Sprintf("apps.%s", name)
+
+		if strings.TrimSpace(spec.Cmd) == "" {
+			return NewConfigError(ErrAppWithoutCmd, "", context, -1)
+		}
+		if err := validateContainerProperties("", Container{App: name}.WithApp(spec), context); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(config.Workspaces)) {
+		workspace := config.Workspaces[name]
+
+		containers, err := config.withApps(workspace.Containers, name, "container")
+		if err != nil {
+			return err
+		}
+		workspace.Containers = containers
+
+		workspace.Variants = slices.Clone(workspace.Variants)
+		for i := range workspace.Variants {
+			context := fmt.Sprintf("variants[%d].container", i)
+			containers, err := config.withApps(workspace.Variants[i].Containers, name, context)
+			if err != nil {
+				return err
+			}
+			workspace.Variants[i].Containers = containers
+		}
+		config.Workspaces[name] = workspace
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(config.Scratchpad)) {
+		entry, err := config.withApp(config.Scratchpad[name], "", fmt.Sprintf("scratchpad.%s", name))
+		if err != nil {
+			return err
+		}
+		config.Scratchpad[name] = entry
+	}
+
+	return nil
+}
+
+// Resolves a list of containers and their children
+func (c *Config) withApps(containers []Container, workspaceName string, context string) ([]Container, error) {
+	resolved := slices.Clone(containers)
+	for i, container := range resolved {
+		current := fmt.Sprintf("%s[%d]", context, i)
+		if len(container.Containers) > 0 {
+			children, err := c.withApps(container.Containers, workspaceName, current+".containers")
+			if err != nil {
+				return nil, err
+			}
+			container.Containers = children
+		}
+
+		container, err := c.withApp(container, workspaceName, current)
+		if err != nil {
+			return nil, err
+		}
+		resolved[i] = container
+	}
+	return resolved, nil
+}
+
+// Resolves an application container against the catalog
+//
+// Without a catalog, applications are launched as commands. Once the
+// configuration has one, an application must be in it or give its own cmd, so
+// that a misspelled name is not launched as a command.
+func (c *Config) withApp(container Container, workspaceName string, context string) (Container, error) {
+	if container.App == "" {
+		return container, nil
+	}
+
+	if spec, found := c.Apps[container.App]; found {
+		return container.WithApp(spec), nil
+	}
+
+	if len(c.Apps) > 0 && container.Cmd == "" {
+		err := fmt.Errorf("%w: '%s'", ErrUnknownApp, container.App)
+		return container, NewConfigError(err, workspaceName, context+".app", -1)
+	}
+
+	return container, nil
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestResolveApps(t *testing.T) {
+	cfg := loadConfigFile(t, ".yml", `
+apps:
+  term:
+    cmd: foot -e zsh
+    delay: 1
+workspaces:
+  dev:
+    layout: h
+    containers:
+      - app: term
+      - app: htop
+        cmd: foot -e htop
+scratchpad:
+  notes:
+    app: term
+`)
+
+	containers := cfg.Workspaces["dev"].Containers
+	tests := []struct {
+		name string
+		got  Container
+		cmd  string
+	}{
+		{"catalog application", containers[0], "foot -e zsh"},
+		{"bare executable with a cmd", containers[1], "foot -e htop"},
+		{"scratchpad entry", cfg.Scratchpad["notes"], "foot -e zsh"},
+	}
+	for _, tt := range tests {
+		if tt.got.Cmd != tt.cmd {
+			t.Errorf("%s: cmd %q, want %q", tt.name, tt.got.Cmd, tt.cmd)
+		}
+	}
+
+	// Without a catalog, applications are commands
+	loadConfigFile(t, ".yml", "workspaces:\n  dev:\n    layout: h\n    containers:\n      - app: foot\n")
+}
+
+func TestResolveAppsErrors(t *testing.T) {
+	catalog := "apps:\n  term:\n    cmd: foot\n"
+	tests := []struct {
+		name     string
+		contents string
+		want     error
+		position string
+	}{
+		{
+			"unknown application",
+			catalog + "workspaces:\n  dev:\n    layout: h\n    containers:\n      - app: term\n      - app: trem\n",
+			ErrUnknownApp,
+			"container[1].app (",
+		},
+		{
+			"unknown nested application",
+			catalog + "workspaces:\n  dev:\n    layout: h\n    containers:\n      - split: v\n        containers:\n          - app: trem\n",
+			ErrUnknownApp,
+			"container[0].containers[0].app (",
+		},
+		{
+			"unknown variant application",
+			catalog + "workspaces:\n  dev:\n    layout: h\n    containers:\n      - app: term\n    variants:\n      - when:\n          outputs: \">=2\"\n        containers:\n          - app: trem\n",
+			ErrUnknownApp,
+			"variants[0].container[0].app (",
+		},
+		{
+			"unknown scratchpad application",
+			catalog + "scratchpad:\n  notes:\n    app: trem\nworkspaces:\n  dev:\n    layout: h\n    containers:\n      - app: term\n",
+			ErrUnknownApp,
+			"scratchpad.notes.app (",
+		},
+		{
+			"catalog application without cmd",
+			"apps:\n  term:\n    delay: 1\nworkspaces:\n  dev:\n    layout: h\n    containers:\n      - app: term\n",
+			ErrAppWithoutCmd,
+			"apps.term (",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := loadConfigError(t, tt.contents)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("LoadConfig() error = %v, want %v", err, tt.want)
+			}
+			if !strings.Contains(err.Error(), tt.position) || !strings.Contains(err.Error(), "config.yml:") {
+				t.Errorf("LoadConfig() error = %q, want it at %s with a line", err, tt.position)
+			}
+		})
+	}
+}
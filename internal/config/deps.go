@@ -0,0 +1,158 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Container referenced by its id
+type ContainerRef struct {
+	Workspace string
+	Context   string // Location in the workspace, e.g. container[1].containers[0]
+	Order     int    // Position of the application in the launch order of the workspace
+	Container Container
+}
+
+// Calls fn for every container of a list, parents before children
+func walkContainers(containers []Container, context string, fn func(context string, container Container)) {
+	for i, container := range containers {
+		current := fmt.Sprintf("%s[%d]", context, i)
+		fn(current, container)
+		walkContainers(container.Containers, current+".containers", fn)
+	}
+}
+
+// Returns the containers with an id, by id
+//
+// Ids are unique once the configuration is validated.
+func (c *Config) ContainerIDs() map[string]ContainerRef {
+	refs := make(map[string]ContainerRef)
+
+	for _, name := range slices.Sorted(maps.Keys(c.Workspaces)) {
+		order := 0
+		walkContainers(c.Workspaces[name].Containers, "container", func(context string, container Container) {
+			if container.App == "" {
+				return
+			}
+			if container.ID != "" {
+				if _, found := refs[container.ID]; !found {
+					refs[container.ID] = ContainerRef{
+						Workspace: name,
+						Context:   context,
+						Order:     order,
+						Container: container,
+					}
+				}
+			}
+			order++
+		})
+	}
+
+	return refs
+}
+
+// Returns the workspace of every container id, nested containers and variants
+// included
+func (c *Config) idWorkspaces() map[string]string {
+	workspaces := make(map[string]string)
+	record := func(name string, containers []Container) {
+		walkContainers(containers, "container", func(_ string, container Container) {
+			if _, found := workspaces[container.ID]; container.ID != "" && !found {
+				workspaces[container.ID] = name
+			}
+		})
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(c.Workspaces)) {
+		record(name, c.Workspaces[name].Containers)
+		for _, variant := range c.Workspaces[name].Variants {
+			record(name, variant.Containers)
+		}
+	}
+	return workspaces
+}
+
+// Whether a focus entry refers to a container by id rather than to a
+// workspace
+func (c *Config) IsFocusID(entry string) bool {
+	if _, found := c.Workspaces[entry]; found {
+		return false
+	}
+	_, found := c.idWorkspaces()[entry]
+	return found
+}
+
+// Returns the other workspaces each workspace depends on through the
+// dependencies of its containers, sorted by name
+func (c *Config) WorkspaceDependencies() map[string][]string {
+	refs := c.ContainerIDs()
+	deps := make(map[string][]string)
+
+	for name, workspace := range c.Workspaces {
+		walkContainers(workspace.Containers, "container", func(_ string, container Container) {
+			for _, id := range container.DependsOn {
+				ref, found := refs[id]
+				if !found || ref.Workspace == name || slices.Contains(deps[name], ref.Workspace) {
+					continue
+				}
+				deps[name] = append(deps[name], ref.Workspace)
+			}
+		})
+		slices.Sort(deps[name])
+	}
+
+	return deps
+}
+
+// Returns a dependency cycle of the graph as a path, or nil when there is none
+//
+// Nodes are visited in name order, so the same cycle is reported every time.
+func findCycle(graph map[string][]string) []string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make(map[string]int)
+	var path []string
+
+	var visit func(node string) []string
+	visit = func(node string) []string {
+		state[node] = visiting
+		path = append(path, node)
+
+		for _, next := range graph[node] {
+			switch state[next] {
+			case visiting:
+				start := slices.Index(path, next)
+				return append(slices.Clone(path[start:]), next)
+			case unvisited:
+				if cycle := visit(next); cycle != nil {
+					return cycle
+				}
+			}
+		}
+
+		path = path[:len(path)-1]
+		state[node] = visited
+		return nil
+	}
+
+	for _, node := range slices.Sorted(maps.Keys(graph)) {
+		if state[node] == unvisited {
+			if cycle := visit(node); cycle != nil {
+				return cycle
+			}
+		}
+	}
+
+	return nil
+}
+
+// Formats a dependency cycle for error messages
+func formatCycle(cycle []string) string {
+	return strings.Join(cycle, " -> ")
+}
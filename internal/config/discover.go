@@ -0,0 +1,130 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/titembaatar/sway.flem/internal/log"
+)
+
+const (
+	// Environment variable listing the configuration files to load,
+	// separated like PATH
+	ConfigEnv = "FLEM_CONFIG"
+	// Path standing for the standard input
+	StdinPath = "-"
+)
+
+var (
+	// Names of a project configuration, looked up from the current directory
+	ProjectConfigNames = []string{".flem.yml", ".flem.yaml"}
+	// Names of the user configuration, in the flem configuration directory
+	UserConfigNames = []string{"config.yml", "config.yaml", "config.json", "config.toml"}
+)
+
+// Configuration files found by DiscoverConfig
+type Discovery struct {
+	Paths   []string
+	Project bool // Found from the current directory, so it must be trusted
+}
+
+// Finds the configuration files to load when none is given
+//
+// The first found of, in order: the files listed by $FLEM_CONFIG; the project
+// configuration closest to the current directory, going up to the root; the
+// user configuration in $XDG_CONFIG_HOME/flem, or ~/.config/flem.
+func DiscoverConfig() (Discovery, error) {
+	if value := os.Getenv(ConfigEnv); value != "" {
+		paths := strings.FieldsFunc(value, func(r rune) bool { return r == os.PathListSeparator })
+		log.Info("Using configuration from $%s: %s", ConfigEnv, strings.Join(paths, ", "))
+		return Discovery{Paths: paths}, nil
+	}
+
+	var searched []string
+
+	dir, err := os.Getwd()
+	if err != nil {
+		return Discovery{}, fmt.Errorf("failed to get current directory: %w", err)
+	}
+	for {
+		path, candidates, err := findFile(dir, ProjectConfigNames)
+		if err != nil {
+			return Discovery{}, err
+		}
+		if path != "" {
+			log.Info("Using project configuration %s", path)
+			return Discovery{Paths: []string{path}, Project: true}, nil
+		}
+		searched = append(searched, candidates...)
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	dir, err = userConfigDir()
+	if err != nil {
+		return Discovery{}, err
+	}
+	path, candidates, err := findFile(dir, UserConfigNames)
+	if err != nil {
+		return Discovery{}, err
+	}
+	if path != "" {
+		log.Info("Using user configuration %s", path)
+		return Discovery{Paths: []string{path}}, nil
+	}
+	searched = append(searched, candidates...)
+
+	log.Debug("Searched for a configuration in: %s", strings.Join(searched, ", "))
+	return Discovery{}, fmt.Errorf("%w: set -config or $%s, or create %s or %s",
+		ErrNoConfigFound, ConfigEnv, filepath.Join(dir, UserConfigNames[0]), ProjectConfigNames[0])
+}
+
+// Returns the first of the named files found in a directory, or an empty
+// path, and the paths looked at
+//
+// Other files found are reported, as they are ignored.
+func findFile(dir string, names []string) (string, []string, error) {
+	var found string
+	var candidates []string
+
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		candidates = append(candidates, path)
+
+		info, err := os.Stat(path)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			continue
+		case err != nil:
+			return "", nil, fmt.Errorf("failed to look for configuration: %w", err)
+		case info.IsDir():
+			continue
+		case found != "":
+			log.Warn("Ignoring configuration %s, as %s is used", path, found)
+		default:
+			found = path
+		}
+	}
+
+	return found, candidates, nil
+}
+
+// Directory of the user configuration
+func userConfigDir() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "flem"), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find configuration directory: %w", err)
+	}
+	return filepath.Join(home, ".config", "flem"), nil
+}
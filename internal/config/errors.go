@@ -3,6 +3,7 @@ package config
 import (
 	"errors"
 	"fmt"
+	"strings"
 )
 
 var (
@@ -13,6 +14,58 @@ var (
 	ErrMissingSplit              = errors.New("nested container has no split defined")
 	ErrInvalidContainerStructure = errors.New("invalid container structure: must be either an app or have nested containers")
 	ErrInvalidSizeFormat         = errors.New("invalid size format: must be a number, optionally followed by 'ppt' or 'px' (e.g., '50', '50ppt', '800px')")
+	ErrNegativeDuration          = errors.New("duration cannot be negative")
+	ErrInvalidMatch              = errors.New("invalid match criteria")
+	ErrMatchOnNestedContainer    = errors.New("match criteria can only be set on app containers")
+	ErrEmptyHook                 = errors.New("hook has no command")
+	ErrHookNotAllowed            = errors.New("hook is only allowed at the top level of the configuration")
+	ErrDependencyOnNested        = errors.New("depends_on and ready can only be set on app containers")
+	ErrNestedDependency          = errors.New("dependency is a nested container, not an app container")
+	ErrInvalidID                 = errors.New("invalid container id: must only contain letters, digits, '_', '-' and '.'")
+	ErrUnknownPostTarget         = errors.New("post action targets an unknown container id")
+	ErrAmbiguousFocus            = errors.New("focus entry is both a workspace name and a container id")
+	ErrDuplicateID               = errors.New("container id is already used")
+	ErrUnknownDependency         = errors.New("dependency refers to an unknown container id")
+	ErrSelfDependency            = errors.New("container cannot depend on itself")
+	ErrDependencyOrder           = errors.New("container can only depend on containers launched before it in the same workspace")
+	ErrDependencyCycle           = errors.New("dependency cycle")
+	ErrFloatingOnNested          = errors.New("floating can only be set on app containers")
+	ErrFloatingOnly              = errors.New("position, width and height can only be set on floating containers")
+	ErrSizeOnFloating            = errors.New("size cannot be set on floating containers, use width and height instead")
+	ErrFloatingFirstChild        = errors.New("first child of a nested container cannot be floating")
+	ErrInvalidScratchpadName     = errors.New("invalid scratchpad name: must only contain letters, digits, '-' and '_'")
+	ErrScratchpadNotApp          = errors.New("scratchpad entries must be app containers")
+	ErrDependencyInScratchpad    = errors.New("id, depends_on and ready cannot be set on scratchpad entries")
+	ErrEmptyOutput               = errors.New("output must have a name, make, model or serial")
+	ErrEmptyVariant              = errors.New("variant must set a layout, containers or an output")
+	ErrInvalidCondition          = errors.New("invalid condition")
+	ErrInvalidGuard              = errors.New("invalid when expression")
+	ErrInvalidVars               = errors.New("vars must map names to strings")
+	ErrInvalidVarName            = errors.New("invalid variable name: must only contain letters, digits and '_', and not start with a digit")
+	ErrUndefinedVar              = errors.New("undefined variable")
+	ErrVarCycle                  = errors.New("variable cycle")
+	ErrDuplicateName             = errors.New("workspace name is already used")
+	ErrInvalidWorkspaceNumber    = errors.New("workspace number cannot be negative")
+	ErrDuplicateNumber           = errors.New("workspace number is already used")
+	ErrAppWithoutCmd             = errors.New("application of the apps catalog has no cmd")
+	ErrUnknownApp                = errors.New("application is not in the apps catalog and has no cmd")
+	ErrInvalidEnv                = errors.New("invalid environment variable name")
+	ErrUnknownTemplate           = errors.New("unknown template")
+	ErrNestedTemplate            = errors.New("templates cannot use other templates")
+	ErrInvalidTemplateArgs       = errors.New("with must map parameter names to strings")
+	ErrUnknownParam              = errors.New("unknown template parameter")
+	ErrMissingParam              = errors.New("missing template argument")
+	ErrNoConfigFile              = errors.New("no configuration file given")
+	ErrInvalidDocument           = errors.New("configuration must be a mapping")
+	ErrIncludeCycle              = errors.New("include cycle")
+	ErrNoConfigFound             = errors.New("no configuration file found")
+	ErrUnknownField              = errors.New("unknown field")
+	ErrInvalidTOML               = errors.New("invalid TOML")
+	ErrStdinReused               = errors.New("the standard input can only be read once")
+	ErrUntrustedConfig           = errors.New("configuration is not trusted")
+	ErrInvalidProbe              = errors.New("invalid readiness probe: must set exactly one of tcp, socket, file, cmd or title")
+	ErrSizeSumExceeded           = errors.New("sizes of sibling containers add up to more than 100ppt")
+	ErrNoSpaceForSiblings        = errors.New("sizes of sibling containers leave no space for the siblings without a size")
 )
 
 type ConfigError struct {
@@ -20,22 +73,40 @@ type ConfigError struct {
 	Workspace string
 	Context   string
 	Index     int
+	Source    string // File and line of the failing value
+	Origin    string // Where the failing definition comes from, e.g. a template
 }
 
 func (e *ConfigError) Error() string {
-	if e.Index >= 0 {
-		return fmt.Sprintf("%s: workspace '%s', %s at index %d: %v",
-			"Configuration error", e.Workspace, e.Context, e.Index, e.Err)
+	var location string
+	if e.Workspace != "" {
+		location = fmt.Sprintf("workspace '%s'", e.Workspace)
 	}
 
 	if e.Context != "" {
-		return fmt.Sprintf("%s: workspace '%s', %s: %v",
-			"Configuration error", e.Workspace, e.Context, e.Err)
+		context := e.Context
+		if e.Index >= 0 {
+			context = fmt.Sprintf("%s at index %d", e.Context, e.Index)
+		}
+		if location != "" {
+			location += ", "
+		}
+		location += context
 	}
 
-	if e.Workspace != "" {
-		return fmt.Sprintf("%s: workspace '%s': %v",
-			"Configuration error", e.Workspace, e.Err)
+	var notes []string
+	if e.Source != "" {
+		notes = append(notes, e.Source)
+	}
+	if e.Origin != "" {
+		notes = append(notes, "from "+e.Origin)
+	}
+	if len(notes) > 0 {
+		location += fmt.Sprintf(" (%s)", strings.Join(notes, ", "))
+	}
+
+	if location != "" {
+		return fmt.Sprintf("%s: %s: %v", "Configuration error", location, e.Err)
 	}
 
 	return fmt.Sprintf("%s: %v", "Configuration error", e.Err)
@@ -0,0 +1,543 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Guard expressions
+//
+//	expr       = or
+//	or         = and { "||" and }
+//	and        = unary { "&&" unary }
+//	unary      = "!" unary | comparison
+//	comparison = operand [ ( "==" | "!=" | "=~" | "<" | "<=" | ">" | ">=" ) operand ]
+//	operand    = "(" expr ")" | call | string | "true" | "false"
+//	call       = name "(" [ string ] ")"
+//
+// Functions: hostname(), env("NAME"), exec("command"), file("path") and
+// time(). Times compare with "HH:MM" strings.
+
+// Type of a guard expression
+type exprType int
+
+const (
+	typeBool exprType = iota
+	typeString
+	typeTime
+)
+
+func (t exprType) String() string {
+	switch t {
+	case typeBool:
+		return "bool"
+	case typeString:
+		return "string"
+	default:
+		return "time"
+	}
+}
+
+// Error in a guard expression, at a column starting at 1
+type ExprError struct {
+	Column int
+	Msg    string
+}
+
+func (e *ExprError) Error() string {
+	return fmt.Sprintf("column %d: %s", e.Column, e.Msg)
+}
+
+// Parsed and type-checked guard expression
+type Guard struct {
+	source string
+	root   exprNode
+}
+
+// Node of a guard expression
+type exprNode interface {
+	Type() exprType
+	// Evaluates to a bool, a string, or minutes since midnight for times
+	Eval(now time.Time) any
+}
+
+// Parses a guard expression, which must be a bool
+func ParseGuard(source string) (*Guard, error) {
+	tokens, err := lexExpr(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &exprParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, &ExprError{Column: tok.pos, Msg: fmt.Sprintf("unexpected '%s'", tok.text)}
+	}
+	if root.Type() != typeBool {
+		return nil, &ExprError{Column: 1, Msg: fmt.Sprintf("expression is a %s, expected a bool", root.Type())}
+	}
+
+	return &Guard{source: source, root: root}, nil
+}
+
+// Whether the guard holds on this machine at the given time
+func (g *Guard) Eval(now time.Time) bool {
+	return g.root.Eval(now).(bool)
+}
+
+// String representation of the guard
+func (g *Guard) String() string {
+	return g.source
+}
+
+// Evaluates a guard expression, where an empty one always holds
+//
+// Expressions are checked by the config validator.
+func evalGuard(source string, now time.Time) (bool, error) {
+	if strings.TrimSpace(source) == "" {
+		return true, nil
+	}
+
+	guard, err := ParseGuard(source)
+	if err != nil {
+		return false, err
+	}
+	return guard.Eval(now), nil
+}
+
+// Lexing
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// Operators, longest first so that prefixes match correctly
+var exprOps = []string{"&&", "||", "==", "!=", "=~", "<=", ">=", "<", ">", "!"}
+
+// Splits an expression into tokens, at columns counted in characters
+func lexExpr(source string) ([]token, error) {
+	var tokens []token
+	column := func(offset int) int {
+		return utf8.RuneCountInString(source[:offset]) + 1
+	}
+
+	for i := 0; i < len(source); {
+		c, size := utf8.DecodeRuneInString(source[i:])
+		pos := column(i)
+
+		switch {
+		case c == utf8.RuneError && size == 1:
+			return nil, &ExprError{Column: pos, Msg: "invalid UTF-8"}
+
+		case unicode.IsSpace(c):
+			i += size
+
+		case c == '(':
+			tokens = append(tokens, token{tokLParen, "(", pos})
+			i++
+
+		case c == ')':
+			tokens = append(tokens, token{tokRParen, ")", pos})
+			i++
+
+		case c == '"' || c == '\'':
+			// Quotes and backslashes are never part of a multi-byte character
+			end := i + 1
+			for end < len(source) && source[end] != byte(c) {
+				if source[end] == '\\' && c == '"' {
+					end++
+				}
+				end++
+			}
+			if end >= len(source) {
+				return nil, &ExprError{Column: pos, Msg: "unterminated string"}
+			}
+
+			text := source[i+1 : end]
+			if c == '"' {
+				unquoted, err := strconv.Unquote(source[i : end+1])
+				if err != nil {
+					return nil, &ExprError{Column: pos, Msg: "invalid string escape"}
+				}
+				text = unquoted
+			}
+			tokens = append(tokens, token{tokString, text, pos})
+			i = end + 1
+
+		case unicode.IsLetter(c) || c == '_':
+			end := i
+			for end < len(source) {
+				r, n := utf8.DecodeRuneInString(source[end:])
+				if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+					break
+				}
+				end += n
+			}
+			tokens = append(tokens, token{tokIdent, source[i:end], pos})
+			i = end
+
+		default:
+			op := ""
+			for _, candidate := range exprOps {
+				if strings.HasPrefix(source[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, &ExprError{Column: pos, Msg: fmt.Sprintf("unexpected character '%c'", c)}
+			}
+			tokens = append(tokens, token{tokOp, op, pos})
+			i += len(op)
+		}
+	}
+
+	return append(tokens, token{tokEOF, "end of expression", column(len(source))}), nil
+}
+
+// Parsing
+
+type exprParser struct {
+	tokens []token
+	next   int
+}
+
+func (p *exprParser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *exprParser) advance() token {
+	tok := p.tokens[p.next]
+	if tok.kind != tokEOF {
+		p.next++
+	}
+	return tok
+}
+
+// Consumes the operator if it is the next token
+func (p *exprParser) acceptOp(op string) (token, bool) {
+	if tok := p.peek(); tok.kind == tokOp && tok.text == op {
+		return p.advance(), true
+	}
+	return token{}, false
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	return p.parseLogical("||", p.parseAnd)
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	return p.parseLogical("&&", p.parseUnary)
+}
+
+// Parses a chain of bool operands joined by a logical operator
+func (p *exprParser) parseLogical(op string, operand func() (exprNode, error)) (exprNode, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		tok, found := p.acceptOp(op)
+		if !found {
+			return left, nil
+		}
+
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		if left.Type() != typeBool || right.Type() != typeBool {
+			return nil, &ExprError{Column: tok.pos, Msg: fmt.Sprintf("'%s' needs bool operands", op)}
+		}
+		left = &logicalNode{and: op == "&&", left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if tok, found := p.acceptOp("!"); found {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if operand.Type() != typeBool {
+			return nil, &ExprError{Column: tok.pos, Msg: "'!' needs a bool operand"}
+		}
+		return &notNode{operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	tok := p.peek()
+	if tok.kind != tokOp || tok.text == "&&" || tok.text == "||" || tok.text == "!" {
+		return left, nil
+	}
+	p.advance()
+
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	return newComparison(tok, left, right)
+}
+
+func (p *exprParser) parseOperand() (exprNode, error) {
+	tok := p.advance()
+
+	switch tok.kind {
+	case tokLParen:
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.advance(); closing.kind != tokRParen {
+			return nil, &ExprError{Column: closing.pos, Msg: fmt.Sprintf("expected ')', found '%s'", closing.text)}
+		}
+		return inner, nil
+
+	case tokString:
+		return &literalNode{value: tok.text, typ: typeString}, nil
+
+	case tokIdent:
+		switch tok.text {
+		case "true", "false":
+			return &literalNode{value: tok.text == "true", typ: typeBool}, nil
+		}
+		return p.parseCall(tok)
+
+	default:
+		return nil, &ExprError{Column: tok.pos, Msg: fmt.Sprintf("unexpected '%s'", tok.text)}
+	}
+}
+
+// Functions of guard expressions, by name
+var exprFuncs = map[string]struct {
+	arg bool // Whether the function takes a string argument
+	typ exprType
+}{
+	"hostname": {false, typeString},
+	"env":      {true, typeString},
+	"exec":     {true, typeBool},
+	"file":     {true, typeBool},
+	"time":     {false, typeTime},
+}
+
+func (p *exprParser) parseCall(name token) (exprNode, error) {
+	fn, found := exprFuncs[name.text]
+	if !found {
+		return nil, &ExprError{Column: name.pos, Msg: fmt.Sprintf("unknown function '%s'", name.text)}
+	}
+
+	if open := p.advance(); open.kind != tokLParen {
+		return nil, &ExprError{Column: open.pos, Msg: fmt.Sprintf("expected '(' after '%s'", name.text)}
+	}
+
+	call := &callNode{name: name.text, typ: fn.typ}
+	if fn.arg {
+		arg := p.advance()
+		if arg.kind != tokString {
+			return nil, &ExprError{Column: arg.pos, Msg: fmt.Sprintf("%s() takes a string argument", name.text)}
+		}
+		call.arg = arg.text
+	}
+
+	if closing := p.advance(); closing.kind != tokRParen {
+		return nil, &ExprError{Column: closing.pos, Msg: fmt.Sprintf("expected ')', found '%s'", closing.text)}
+	}
+
+	return call, nil
+}
+
+// Builds a comparison, checking the types of its operands
+func newComparison(op token, left, right exprNode) (exprNode, error) {
+	fail := func(msg string, args ...any) (exprNode, error) {
+		return nil, &ExprError{Column: op.pos, Msg: fmt.Sprintf(msg, args...)}
+	}
+
+	if op.text == "=~" {
+		pattern, ok := right.(*literalNode)
+		if left.Type() != typeString || !ok || pattern.typ != typeString {
+			return fail("'=~' needs a string and a regular expression string")
+		}
+		re, err := regexp.Compile(pattern.value.(string))
+		if err != nil {
+			return fail("invalid regular expression: %v", err)
+		}
+		return &matchNode{operand: left, pattern: re}, nil
+	}
+
+	// Time strings become times when compared with one
+	var err error
+	if left.Type() == typeTime {
+		right, err = timeOperand(right)
+	} else if right.Type() == typeTime {
+		left, err = timeOperand(left)
+	}
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	if left.Type() != right.Type() {
+		return fail("cannot compare %s with %s", left.Type(), right.Type())
+	}
+
+	switch op.text {
+	case "==", "!=":
+	case "<", "<=", ">", ">=":
+		if left.Type() != typeTime {
+			return fail("'%s' only compares times", op.text)
+		}
+	default:
+		return fail("unexpected '%s'", op.text)
+	}
+
+	return &compareNode{op: op.text, left: left, right: right}, nil
+}
+
+// Converts an "HH:MM" string literal to a time
+func timeOperand(n exprNode) (exprNode, error) {
+	if n.Type() == typeTime {
+		return n, nil
+	}
+
+	literal, ok := n.(*literalNode)
+	if !ok || literal.typ != typeString {
+		return nil, fmt.Errorf("times only compare with \"HH:MM\" strings")
+	}
+
+	t, err := time.Parse("15:04", literal.value.(string))
+	if err != nil {
+		return nil, fmt.Errorf("invalid time '%s', expected \"HH:MM\"", literal.value)
+	}
+	return &literalNode{value: t.Hour()*60 + t.Minute(), typ: typeTime}, nil
+}
+
+// Nodes
+
+type literalNode struct {
+	value any
+	typ   exprType
+}
+
+func (n *literalNode) Type() exprType     { return n.typ }
+func (n *literalNode) Eval(time.Time) any { return n.value }
+
+type callNode struct {
+	name string
+	arg  string
+	typ  exprType
+}
+
+func (n *callNode) Type() exprType { return n.typ }
+
+func (n *callNode) Eval(now time.Time) any {
+	switch n.name {
+	case "hostname":
+		hostname, _ := os.Hostname()
+		return hostname
+	case "env":
+		return os.Getenv(n.arg)
+	case "exec":
+		_, err := exec.LookPath(n.arg)
+		return err == nil
+	case "file":
+		_, err := os.Stat(ExpandPath(n.arg))
+		return err == nil
+	default:
+		return now.Hour()*60 + now.Minute()
+	}
+}
+
+type notNode struct {
+	operand exprNode
+}
+
+func (n *notNode) Type() exprType         { return typeBool }
+func (n *notNode) Eval(now time.Time) any { return !n.operand.Eval(now).(bool) }
+
+type logicalNode struct {
+	and         bool
+	left, right exprNode
+}
+
+func (n *logicalNode) Type() exprType { return typeBool }
+
+func (n *logicalNode) Eval(now time.Time) any {
+	left := n.left.Eval(now).(bool)
+	if n.and {
+		return left && n.right.Eval(now).(bool)
+	}
+	return left || n.right.Eval(now).(bool)
+}
+
+type matchNode struct {
+	operand exprNode
+	pattern *regexp.Regexp
+}
+
+func (n *matchNode) Type() exprType { return typeBool }
+
+func (n *matchNode) Eval(now time.Time) any {
+	return n.pattern.MatchString(n.operand.Eval(now).(string))
+}
+
+type compareNode struct {
+	op          string
+	left, right exprNode
+}
+
+func (n *compareNode) Type() exprType { return typeBool }
+
+func (n *compareNode) Eval(now time.Time) any {
+	left, right := n.left.Eval(now), n.right.Eval(now)
+
+	switch n.op {
+	case "==":
+		return left == right
+	case "!=":
+		return left != right
+	}
+
+	// Ordering only applies to times
+	l, r := left.(int), right.(int)
+	switch n.op {
+	case "<":
+		return l < r
+	case "<=":
+		return l <= r
+	case ">":
+		return l > r
+	default:
+		return l >= r
+	}
+}
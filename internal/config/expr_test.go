@@ -0,0 +1,149 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLexExpr(t *testing.T) {
+	tests := []struct {
+		source string
+		want   []token
+	}{
+		{
+			`env("HOME") == "/home/flem"`,
+			[]token{{tokIdent, "env", 1}, {tokLParen, "(", 4}, {tokString, "HOME", 5}, {tokRParen, ")", 11}, {tokOp, "==", 13}, {tokString, "/home/flem", 16}, {tokEOF, "end of expression", 28}},
+		},
+		{
+			`hostname() =~ "^bür" && !file('~/日本')`,
+			[]token{{tokIdent, "hostname", 1}, {tokLParen, "(", 9}, {tokRParen, ")", 10}, {tokOp, "=~", 12}, {tokString, "^bür", 15}, {tokOp, "&&", 22}, {tokOp, "!", 25}, {tokIdent, "file", 26}, {tokLParen, "(", 30}, {tokString, "~/日本", 31}, {tokRParen, ")", 37}, {tokEOF, "end of expression", 38}},
+		},
+		{
+			`"é\t" != héllo_2`,
+			[]token{{tokString, "é\t", 1}, {tokOp, "!=", 7}, {tokIdent, "héllo_2", 10}, {tokEOF, "end of expression", 17}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			got, err := lexExpr(tt.source)
+			if err != nil {
+				t.Fatalf("lexExpr() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("lexExpr() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("token %d = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseGuardErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		column int
+		msg    string
+	}{
+		{"unterminated string", `env("HOME`, 5, "unterminated string"},
+		{"invalid escape", `env("\q")`, 5, "invalid string escape"},
+		{"invalid UTF-8", "true && \xff", 9, "invalid UTF-8"},
+		{"unexpected character", `hostname() == "é" ; true`, 19, "unexpected character ';'"},
+		{"unknown function", `"日本" == x()`, 9, "unknown function 'x'"},
+		{"unknown unicode function", `héllo()`, 1, "unknown function 'héllo'"},
+		{"missing parenthesis", `env "HOME"`, 5, "expected '(' after 'env'"},
+		{"missing argument", `env()`, 5, "env() takes a string argument"},
+		{"unclosed group", `(true && false`, 15, "expected ')', found 'end of expression'"},
+		{"trailing token", `true false`, 6, "unexpected 'false'"},
+		{"missing operand", `true &&`, 8, "unexpected 'end of expression'"},
+		{"string result", `hostname()`, 1, "expression is a string, expected a bool"},
+		{"and on strings", `env("A") && true`, 10, "'&&' needs bool operands"},
+		{"or on strings", `true || "ü"`, 6, "'||' needs bool operands"},
+		{"not on a string", `!env("A")`, 1, "'!' needs a bool operand"},
+		{"match on a bool", `file("a") =~ "x"`, 11, "'=~' needs a string and a regular expression string"},
+		{"match with a call", `env("A") =~ env("B")`, 10, "'=~' needs a string and a regular expression string"},
+		{"invalid regexp", `hostname() =~ "("`, 12, "invalid regular expression: error parsing regexp: missing closing ): `(`"},
+		{"string with bool", `env("A") == true`, 10, "cannot compare string with bool"},
+		{"ordered strings", `env("A") < "b"`, 10, "'<' only compares times"},
+		{"time with a call", `time() > env("A")`, 8, "times only compare with \"HH:MM\" strings"},
+		{"invalid time", `time() >= "25:00"`, 8, "invalid time '25:00', expected \"HH:MM\""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseGuard(tt.source)
+			var exprErr *ExprError
+			if !errors.As(err, &exprErr) {
+				t.Fatalf("ParseGuard() error = %v, want an expression error", err)
+			}
+			if exprErr.Column != tt.column || exprErr.Msg != tt.msg {
+				t.Errorf("ParseGuard() error = %q, want %q", err, (&ExprError{Column: tt.column, Msg: tt.msg}).Error())
+			}
+		})
+	}
+}
+
+func TestEvalGuard(t *testing.T) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Skipf("no hostname: %v", err)
+	}
+	t.Setenv("FLEM_TEST_PLACE", "café")
+	t.Setenv("FLEM_TEST_EMPTY", "")
+
+	dir := filepath.Join(t.TempDir(), "日本")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2026, 1, 2, 9, 30, 0, 0, time.Local)
+	tests := []struct {
+		source string
+		want   bool
+	}{
+		{``, true},
+		{`true`, true},
+		{`!true`, false},
+		{`!!true`, true},
+		{`true && false`, false},
+		{`false || true`, true},
+		{`false || true && false`, false},
+		{`(false || true) && !false`, true},
+		{`hostname() == "` + hostname + `"`, true},
+		{`hostname() != "` + hostname + `"`, false},
+		{`env("FLEM_TEST_PLACE") == "café"`, true},
+		{`env("FLEM_TEST_PLACE") =~ "^caf.$"`, true},
+		{`env("FLEM_TEST_PLACE") =~ "^caf..$"`, false},
+		{`env("FLEM_TEST_EMPTY") == ''`, true},
+		{`env("FLEM_TEST_UNSET") == ""`, true},
+		{`file("` + dir + `")`, true},
+		{`file("` + dir + `/missing")`, false},
+		{`exec("sh")`, true},
+		{`exec("flem-test-missing")`, false},
+		{`time() >= "09:30"`, true},
+		{`time() > "09:30"`, false},
+		{`"09:00" < time() && time() < "17:00"`, true},
+		{`time() <= "09:29"`, false},
+		{`time() == "09:30"`, true},
+		{`time() != "9:30"`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			got, err := evalGuard(tt.source, now)
+			if err != nil {
+				t.Fatalf("evalGuard() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("evalGuard() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
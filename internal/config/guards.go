@@ -0,0 +1,154 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
+
+// Part of the configuration left out because its guard does not hold
+type Exclusion struct {
+	Workspace string // Empty for scratchpad entries
+	Context   string // Location of the container, empty for a whole workspace
+	Reason    string
+}
+
+func (e Exclusion) String() string {
+	switch {
+	case e.Workspace == "":
+		return fmt.Sprintf("%s: %s", e.Context, e.Reason)
+	case e.Context == "":
+		return fmt.Sprintf("workspace '%s': %s", e.Workspace, e.Reason)
+	default:
+		return fmt.Sprintf("workspace '%s', %s: %s", e.Workspace, e.Context, e.Reason)
+	}
+}
+
+// Returns a copy of the configuration without the workspaces, containers and
+// scratchpad entries whose guard does not hold at the given time
+//
+// Nested containers and workspaces left without containers are removed as
+// well. Dependencies are checked again, as a guard may remove a container
+// others depend on, and their errors point at the containers as written.
+func ApplyGuards(c *Config, now time.Time) (*Config, []Exclusion, error) {
+	resolved := *c
+	resolved.Workspaces = make(map[string]Workspace, len(c.Workspaces))
+	resolved.contexts = make(map[string]map[string]string)
+	var excluded []Exclusion
+
+	for _, name := range slices.Sorted(maps.Keys(c.Workspaces)) {
+		workspace := c.Workspaces[name]
+
+		holds, err := evalGuard(workspace.When, now)
+		if err != nil {
+			return nil, nil, NewConfigError(fmt.Errorf("%w: %v", ErrInvalidGuard, err), name, "when", -1)
+		}
+		if !holds {
+			excluded = append(excluded, Exclusion{Workspace: name, Reason: "when " + workspace.When})
+			continue
+		}
+
+		f := guardFilter{workspace: name, now: now, written: make(map[string]string)}
+		workspace.Containers = f.filter(workspace.Containers, "container", "container")
+		workspace.Variants = slices.Clone(workspace.Variants)
+		for i := range workspace.Variants {
+			context := fmt.Sprintf("variants[%d].container", i)
+			workspace.Variants[i].Containers = f.filter(workspace.Variants[i].Containers, context, context)
+		}
+		resolved.contexts[name] = f.written
+		excluded = append(excluded, f.excluded...)
+		if f.err != nil {
+			return nil, nil, f.err
+		}
+
+		if len(workspace.Containers) == 0 {
+			excluded = append(excluded, Exclusion{Workspace: name, Reason: "all its containers are excluded"})
+			continue
+		}
+		resolved.Workspaces[name] = workspace
+	}
+
+	if c.Scratchpad != nil {
+		resolved.Scratchpad = make(map[string]Container, len(c.Scratchpad))
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.Scratchpad)) {
+		entry := c.Scratchpad[name]
+		context := fmt.Sprintf("scratchpad.%s", name)
+
+		holds, err := evalGuard(entry.When, now)
+		if err != nil {
+			return nil, nil, NewConfigError(fmt.Errorf("%w: %v", ErrInvalidGuard, err), "", context+".when", -1)
+		}
+		if !holds {
+			excluded = append(excluded, Exclusion{Context: context, Reason: "when " + entry.When})
+			continue
+		}
+		resolved.Scratchpad[name] = entry
+	}
+
+	resolved.Focus = nil
+	ids := resolved.idWorkspaces()
+	for _, name := range c.Focus {
+		_, isWorkspace := resolved.Workspaces[name]
+		_, isID := ids[name]
+		if isWorkspace || isID {
+			resolved.Focus = append(resolved.Focus, name)
+		}
+	}
+
+	if err := validateDependencies(&resolved); err != nil {
+		return nil, nil, resolved.locateError(err)
+	}
+	return &resolved, excluded, nil
+}
+
+// Removes the containers of a workspace whose guard does not hold
+type guardFilter struct {
+	workspace string
+	now       time.Time
+	excluded  []Exclusion
+	written   map[string]string // Context as written of each kept container
+	err       error
+}
+
+// Filters a list of containers, found at a context of the filtered
+// configuration and at another as written
+func (f *guardFilter) filter(containers []Container, context string, writtenContext string) []Container {
+	var kept []Container
+
+	for i, container := range containers {
+		if f.err != nil {
+			return nil
+		}
+		current := fmt.Sprintf("%s[%d]", writtenContext, i)
+
+		holds, err := evalGuard(container.When, f.now)
+		if err != nil {
+			f.err = NewConfigError(fmt.Errorf("%w: %v", ErrInvalidGuard, err), f.workspace, current+".when", -1)
+			return nil
+		}
+		if !holds {
+			f.excluded = append(f.excluded, Exclusion{Workspace: f.workspace, Context: current, Reason: "when " + container.When})
+			continue
+		}
+
+		filtered := fmt.Sprintf("%s[%d]", context, len(kept))
+		f.written[filtered] = current
+
+		if len(container.Containers) > 0 {
+			container.Containers = f.filter(container.Containers, filtered+".containers", current+".containers")
+			if len(container.Containers) == 0 {
+				continue
+			}
+			if container.Containers[0].Floating {
+				f.err = NewConfigError(ErrFloatingFirstChild, f.workspace, current+".containers[0]", -1)
+				return nil
+			}
+		}
+
+		kept = append(kept, container)
+	}
+
+	return kept
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApplyGuardsErrorPositions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	contents := `workspaces:
+  dev:
+    layout: h
+    containers:
+      - id: editor
+        app: editor
+        when: "false"
+      - split: v
+        containers:
+          - app: shell
+            when: "false"
+          - app: logs
+            depends_on: [editor]
+`
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig([]string{path}, LoadOptions{})
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+
+	_, _, err = ApplyGuards(cfg, time.Now())
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) {
+		t.Fatalf("ApplyGuards() error = %v, want a configuration error", err)
+	}
+	if !errors.Is(err, ErrUnknownDependency) {
+		t.Errorf("ApplyGuards() error = %v, want %v", err, ErrUnknownDependency)
+	}
+	if want := "container[1].containers[1]"; !strings.HasPrefix(configErr.Context, want) {
+		t.Errorf("error context = %q, want it at %s", configErr.Context, want)
+	}
+	if want := path + ":13"; configErr.Source != want {
+		t.Errorf("error source = %q, want %q", configErr.Source, want)
+	}
+}
@@ -0,0 +1,455 @@
+package config
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/titembaatar/sway.flem/internal/log"
+	"gopkg.in/yaml.v3"
+)
+
+// One or more paths, written as a string or a list
+type Paths []string
+
+// yaml.Unmarshaler interface, accepting a single path
+func (p *Paths) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*p = Paths{node.Value}
+		return nil
+	}
+
+	type plain Paths
+	return node.Decode((*plain)(p))
+}
+
+// Files the nodes of a configuration come from
+type sources map[*yaml.Node]string
+
+// Records the file of a node and its descendants
+func (s sources) add(node *yaml.Node, file string) {
+	s[node] = file
+	for _, child := range node.Content {
+		s.add(child, file)
+	}
+}
+
+// Position of a node as '<file>:<line>', or its file alone for nodes of TOML
+// files
+func (s sources) position(node *yaml.Node) string {
+	if node == nil {
+		return ""
+	}
+	file, found := s[node]
+	switch {
+	case node.Line == 0:
+		return file
+	case found:
+		return fmt.Sprintf("%s:%d", file, node.Line)
+	}
+	return fmt.Sprintf("line %d", node.Line)
+}
+
+// Merged configuration document and where its values come from
+type configSource struct {
+	doc   *yaml.Node
+	files sources
+
+	digest hash.Hash // Paths and contents of the files read, in order
+	strict bool      // Whether unknown fields are errors rather than warnings
+}
+
+// Names the file of the position a variable or template error points at
+func (s *configSource) annotate(err error) error {
+	var varErr *VarError
+	var templateErr *TemplateError
+	switch {
+	case errors.As(err, &varErr):
+		varErr.File = s.files[varErr.node]
+	case errors.As(err, &templateErr):
+		templateErr.File = s.files[templateErr.node]
+	}
+	return err
+}
+
+// Loads configuration files, each with its includes, and merges them in
+// order, later files overriding earlier ones
+func loadDocuments(paths []string, strict bool) (*configSource, error) {
+	source := &configSource{
+		doc:    &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"},
+		files:  make(sources),
+		digest: sha256.New(),
+		strict: strict,
+	}
+
+	stdin := 0
+	for _, path := range paths {
+		if path == StdinPath {
+			stdin++
+		}
+	}
+	if stdin > 1 {
+		return nil, ErrStdinReused
+	}
+
+	for _, path := range paths {
+		doc, err := source.loadDocument(path, nil)
+		if err != nil {
+			return nil, err
+		}
+		source.doc = mergeNodes(source.doc, doc, "")
+	}
+
+	return source, nil
+}
+
+// Loads a configuration file with the files it includes merged under it
+//
+// Included paths are relative to the including file and may be globs; a glob
+// matching no file is not an error. Stack holds the absolute paths of the
+// files being included, to detect cycles.
+func (s *configSource) loadDocument(path string, stack []string) (*yaml.Node, error) {
+	absPath, dir := StdinPath, "."
+	if path != StdinPath {
+		var err error
+		if absPath, err = filepath.Abs(path); err != nil {
+			return nil, fmt.Errorf("failed to get absolute path: %w", err)
+		}
+		dir = filepath.Dir(path)
+	}
+
+	if slices.Contains(stack, absPath) {
+		cycle := strings.Join(append(stack, absPath), " -> ")
+		return nil, fmt.Errorf("%w: %s", ErrIncludeCycle, cycle)
+	}
+	stack = append(stack, absPath)
+
+	if len(stack) == 1 {
+		log.Info("Loading configuration from %s", displayPath(absPath))
+	} else {
+		log.Debug("Including configuration from %s", displayPath(absPath))
+	}
+
+	data, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(s.digest, "%s\x00%d\x00", absPath, len(data))
+	s.digest.Write(data)
+
+	doc, err := parseDocument(path, data)
+	if err != nil {
+		return nil, err
+	}
+	path = displayPath(path)
+	s.files.add(doc, path)
+
+	if err := checkFields(doc, s.files, s.strict); err != nil {
+		return nil, err
+	}
+
+	include := mappingValue(doc, "include")
+	removeMappingKey(doc, "include")
+	if include == nil {
+		return doc, nil
+	}
+
+	var patterns Paths
+	if err := include.Decode(&patterns); err != nil {
+		return nil, fmt.Errorf("%s: include: %w", path, err)
+	}
+
+	merged := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, pattern := range patterns {
+		included, err := resolveInclude(dir, pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, include.Line, err)
+		}
+
+		for _, file := range included {
+			includedDoc, err := s.loadDocument(file, stack)
+			if err != nil {
+				return nil, err
+			}
+			merged = mergeNodes(merged, includedDoc, "")
+		}
+	}
+
+	return mergeNodes(merged, doc, ""), nil
+}
+
+// Reads a configuration file, or the standard input
+func readFile(path string) ([]byte, error) {
+	var data []byte
+	var err error
+	if path == StdinPath {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("config file not found: %w", err)
+		}
+		return nil, fmt.Errorf("failed to open config file: %w", err)
+	}
+	return data, nil
+}
+
+// Parses a configuration file
+//
+// Files ending in .toml are TOML; others are YAML, which JSON is a subset of.
+func parseDocument(path string, data []byte) (*yaml.Node, error) {
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		doc, err := parseTOML(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", displayPath(path), err)
+		}
+		return doc, nil
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("%s: %w", displayPath(path), err)
+	}
+
+	doc := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		doc = root.Content[0]
+	}
+	if doc.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s: %w", displayPath(path), ErrInvalidDocument)
+	}
+	return doc, nil
+}
+
+// Name of a configuration file in messages
+func displayPath(path string) string {
+	if path == StdinPath {
+		return "<stdin>"
+	}
+	return path
+}
+
+// Returns the files an include pattern refers to, relative to a directory
+func resolveInclude(dir string, pattern string) ([]string, error) {
+	pattern = ExpandPath(pattern)
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(dir, pattern)
+	}
+
+	if !strings.ContainsAny(pattern, "*?[") {
+		if _, err := os.Stat(pattern); err != nil {
+			return nil, fmt.Errorf("failed to include %s: %w", pattern, err)
+		}
+		return []string{pattern}, nil
+	}
+
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid include pattern '%s': %w", pattern, err)
+	}
+	if len(files) == 0 {
+		log.Debug("Include pattern %s matches no file", pattern)
+	}
+	return files, nil
+}
+
+// Reports the fields of a configuration file unknown to their type, as
+// warnings, or fails on the first one in strict mode
+//
+// Values are checked once templates and variables are substituted.
+func checkFields(doc *yaml.Node, files sources, strict bool) error {
+	for _, key := range unknownFields(doc, reflect.TypeFor[Config](), nil) {
+		if strict {
+			return fmt.Errorf("%s: %w '%s'", files.position(key), ErrUnknownField, key.Value)
+		}
+		log.Warn("Ignoring unknown field '%s' (%s)", key.Value, files.position(key))
+	}
+	return nil
+}
+
+// Appends the keys of the fields under a node unknown to the type it decodes
+// into
+//
+// A mapping may stand for the single item of a list, as outputs do.
+func unknownFields(node *yaml.Node, t reflect.Type, keys []*yaml.Node) []*yaml.Node {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case node.Kind == yaml.MappingNode && t.Kind() == reflect.Struct:
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			fieldType, found := fields[node.Content[i].Value]
+			if !found {
+				keys = append(keys, node.Content[i])
+				continue
+			}
+			keys = unknownFields(node.Content[i+1], fieldType, keys)
+		}
+	case node.Kind == yaml.MappingNode && t.Kind() == reflect.Map:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			keys = unknownFields(node.Content[i+1], t.Elem(), keys)
+		}
+	case node.Kind == yaml.MappingNode && t.Kind() == reflect.Slice:
+		keys = unknownFields(node, t.Elem(), keys)
+	case node.Kind == yaml.SequenceNode && t.Kind() == reflect.Slice:
+		for _, item := range node.Content {
+			keys = unknownFields(item, t.Elem(), keys)
+		}
+	}
+	return keys
+}
+
+// Types of the fields of a struct by YAML name, inlined structs included
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for _, field := range reflect.VisibleFields(t) {
+		if !field.IsExported() || len(field.Index) > 1 && !inlined(t, field.Index) {
+			continue
+		}
+
+		name, options, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		switch {
+		case name == "-", options == "inline":
+			continue
+		case name == "":
+			name = strings.ToLower(field.Name)
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+// Whether the embedded structs leading to a promoted field are all inlined
+func inlined(t reflect.Type, index []int) bool {
+	for _, i := range index[:len(index)-1] {
+		field := t.Field(i)
+		if _, options, _ := strings.Cut(field.Tag.Get("yaml"), ","); options != "inline" {
+			return false
+		}
+		t = field.Type
+	}
+	return true
+}
+
+// Merges an overlay node over a base node and returns the result
+//
+// Mappings are merged key by key, a null value removing the key from the
+// base. Containers are merged by id and appended otherwise. Other values,
+// lists included, are replaced.
+func mergeNodes(base, overlay *yaml.Node, key string) *yaml.Node {
+	switch {
+	case base == nil:
+		return overlay
+	case base.Kind == yaml.MappingNode && overlay.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(overlay.Content); i += 2 {
+			k, v := overlay.Content[i], overlay.Content[i+1]
+
+			index := mappingIndex(base, k.Value)
+			switch {
+			case index < 0:
+				base.Content = append(base.Content, k, v)
+			case v.Kind == yaml.ScalarNode && v.Tag == "!!null":
+				base.Content = slices.Delete(base.Content, index, index+2)
+			default:
+				base.Content[index+1] = mergeNodes(base.Content[index+1], v, k.Value)
+			}
+		}
+		return base
+	case key == "containers" && base.Kind == yaml.SequenceNode && overlay.Kind == yaml.SequenceNode:
+		for _, item := range overlay.Content {
+			if !mergeContainer(base, item) {
+				base.Content = append(base.Content, item)
+			}
+		}
+		return base
+	default:
+		return overlay
+	}
+}
+
+// Merges a container into the container of a list, or of its nested lists,
+// with the same id; returns whether one was found
+func mergeContainer(containers *yaml.Node, overlay *yaml.Node) bool {
+	id := mappingValue(overlay, "id")
+	if id == nil || id.Kind != yaml.ScalarNode {
+		return false
+	}
+
+	for i, container := range containers.Content {
+		if existing := mappingValue(container, "id"); existing != nil && existing.Value == id.Value {
+			containers.Content[i] = mergeNodes(container, overlay, "")
+			return true
+		}
+		if nested := mappingValue(container, "containers"); nested != nil && nested.Kind == yaml.SequenceNode {
+			if mergeContainer(nested, overlay) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+var contextPartRegex = regexp.MustCompile(`^([a-z_]+)(?:\[(\d+)\])?$`)
+
+// Finds the node a validation error refers to, or the closest one found
+func (s *configSource) locate(workspace string, context string, index int) *yaml.Node {
+	node := s.doc
+	if workspace != "" {
+		node = mappingValue(mappingValue(s.doc, "workspaces"), workspace)
+	}
+
+	var parts []string
+	if context != "" {
+		parts = strings.Split(context, ".")
+	}
+
+	// Scratchpad entries and catalog applications have free names
+	if workspace == "" && len(parts) >= 2 && (parts[0] == "scratchpad" || parts[0] == "apps") {
+		node = mappingValue(mappingValue(s.doc, parts[0]), parts[1])
+		parts = parts[2:]
+	}
+
+	for _, part := range parts {
+		match := contextPartRegex.FindStringSubmatch(part)
+		if node == nil || match == nil {
+			break
+		}
+
+		key := match[1]
+		if key == "container" {
+			key = "containers"
+		}
+
+		next := mappingValue(node, key)
+		if next == nil {
+			break
+		}
+		node = next
+
+		if match[2] != "" {
+			i, _ := strconv.Atoi(match[2])
+			if node.Kind != yaml.SequenceNode || i >= len(node.Content) {
+				break
+			}
+			node = node.Content[i]
+		}
+	}
+
+	if node != nil && index >= 0 && node.Kind == yaml.SequenceNode && index < len(node.Content) {
+		node = node.Content[index]
+	}
+	return node
+}
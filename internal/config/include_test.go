@@ -0,0 +1,60 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const unknownFieldsConfig = `workspaces:
+  dev:
+    layout: h
+    colour: blue
+    containers:
+      - app: editor
+        sise: 50ppt
+        output: [{name: DP-1, port: 2}]
+`
+
+func TestUnknownFields(t *testing.T) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(unknownFieldsConfig), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, key := range unknownFields(doc.Content[0], reflect.TypeFor[Config](), nil) {
+		got = append(got, key.Value)
+	}
+	if want := []string{"colour", "sise", "output"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unknownFields() = %v, want %v", got, want)
+	}
+}
+
+func TestCheckFieldsStrict(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(unknownFieldsConfig), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig([]string{path}, LoadOptions{})
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v, want unknown fields ignored", err)
+	}
+	if got := cfg.Workspaces["dev"].Containers[0].App; got != "editor" {
+		t.Errorf("app = %q, want %q", got, "editor")
+	}
+
+	_, err = LoadConfig([]string{path}, LoadOptions{Strict: true})
+	if !errors.Is(err, ErrUnknownField) {
+		t.Fatalf("LoadConfig() error = %v, want %v", err, ErrUnknownField)
+	}
+	if want := path + ":4"; !strings.Contains(err.Error(), want) || !strings.Contains(err.Error(), "'colour'") {
+		t.Errorf("LoadConfig() error = %q, want 'colour' at %s", err, want)
+	}
+}
@@ -1,49 +1,44 @@
 package config
 
 import (
-	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/titembaatar/sway.flem/internal/log"
-	"gopkg.in/yaml.v3"
 )
 
-func LoadConfig(path string) (*Config, error) {
+// Options of configuration loading
+type LoadOptions struct {
+	Vars   map[string]string // Variable overrides, over the vars block and the environment
+	Strict bool              // Fail on unknown fields instead of warning about them
+}
+
+// Loads and validates configuration files, merged in order
+//
+// Each file is merged over the files it includes, and later files over
+// earlier ones.
+func LoadConfig(paths []string, opts LoadOptions) (*Config, error) {
 	log.SetComponent(log.ComponentConfig)
 
 	loadOp := log.Operation("config loading")
 	loadOp.Begin()
 
-	absPath, err := filepath.Abs(path)
-	if err != nil {
-		loadOp.EndWithError(err)
-		return nil, fmt.Errorf("failed to get absolute path: %w", err)
+	if len(paths) == 0 {
+		loadOp.EndWithError(ErrNoConfigFile)
+		return nil, ErrNoConfigFile
 	}
 
-	log.Info("Loading configuration from %s", absPath)
-
-	file, err := os.Open(absPath)
+	source, err := loadDocuments(paths, opts.Strict)
 	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			log.Error("Configuration file not found: %s", absPath)
-			loadErr := fmt.Errorf("config file not found: %w", err)
-			loadOp.EndWithError(loadErr)
-			return nil, loadErr
-		}
-		log.Error("Failed to open configuration file: %v", err)
-		loadErr := fmt.Errorf("failed to open config file: %w", err)
-		loadOp.EndWithError(loadErr)
-		return nil, loadErr
+		log.Error("Failed to read configuration: %v", err)
+		loadOp.EndWithError(err)
+		return nil, err
 	}
-	defer file.Close()
-
-	var config Config
-	decoder := yaml.NewDecoder(file)
-	decoder.KnownFields(true)
 
-	if err := decoder.Decode(&config); err != nil {
+	config, err := decodeConfig(source, opts.Vars)
+	if err != nil {
 		log.Error("Failed to parse YAML configuration: %v", err)
 		loadErr := fmt.Errorf("failed to decode config: %w", err)
 		loadOp.EndWithError(loadErr)
@@ -55,7 +50,7 @@ func LoadConfig(path string) (*Config, error) {
 	validateOp := log.Operation("config validation")
 	validateOp.Begin()
 
-	if err := ValidateConfig(&config); err != nil {
+	if err := ValidateConfig(config); err != nil {
 		log.Error("Configuration validation failed: %v", err)
 		validateOp.EndWithError(err)
 		loadOp.EndWithError(err)
@@ -74,5 +69,51 @@ func LoadConfig(path string) (*Config, error) {
 	}
 
 	loadOp.End()
+	return config, nil
+}
+
+// Decodes a merged configuration, instantiating its templates and
+// substituting its variables
+func decodeConfig(source *configSource, overrides map[string]string) (*Config, error) {
+	doc := source.doc
+
+	s, err := newSubstitution(doc, overrides)
+	if err != nil {
+		return nil, source.annotate(err)
+	}
+
+	origins, err := expandTemplates(doc, s, source.files)
+	if err != nil {
+		return nil, source.annotate(err)
+	}
+
+	if err := s.substituteDocument(doc); err != nil {
+		return nil, source.annotate(err)
+	}
+
+	var config Config
+	if err := doc.Decode(&config); err != nil {
+		return nil, err
+	}
+	config.Vars = s.resolved
+	config.source = source
+
+	for node, origin := range origins {
+		workspace := config.Workspaces[node.Value]
+		workspace.origin = origin
+		config.Workspaces[node.Value] = workspace
+	}
+
 	return &config, nil
 }
+
+// Expands '~' and environment variables in a path
+func ExpandPath(path string) string {
+	path = os.ExpandEnv(path)
+	if rest, found := strings.CutPrefix(path, "~"); found && (rest == "" || rest[0] == '/') {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return path
+}
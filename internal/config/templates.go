@@ -0,0 +1,202 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Workspace definition with parameters, instantiated by workspaces with use
+//
+// Parameters are referred to as ${name} anywhere in the definition.
+type Template struct {
+	Params    map[string]*string `yaml:"params" json:"params"` // Default values, nil when required
+	Workspace `yaml:",inline"`
+}
+
+// Template error at a position of the configuration file
+type TemplateError struct {
+	Err      error
+	Template string
+	File     string
+	Line     int
+	Column   int
+
+	node *yaml.Node
+}
+
+func (e *TemplateError) Error() string {
+	position := formatPosition(e.File, e.Line, e.Column)
+	if position == "" {
+		return fmt.Sprintf("template '%s': %v", e.Template, e.Err)
+	}
+	return fmt.Sprintf("%s: template '%s': %v", position, e.Template, e.Err)
+}
+
+func (e *TemplateError) Unwrap() error {
+	return e.Err
+}
+
+func NewTemplateError(err error, template string, node *yaml.Node) *TemplateError {
+	return &TemplateError{Err: err, Template: template, Line: node.Line, Column: node.Column, node: node}
+}
+
+// Replaces the workspaces of a configuration document that use a template by
+// the instantiated template
+//
+// Fields set by the workspace take precedence over those of the template.
+// Arguments may refer to variables. Returns where each instantiated workspace
+// comes from, by the node of its name, for error messages.
+func expandTemplates(doc *yaml.Node, s *substitution, files sources) (map[*yaml.Node]string, error) {
+	templates := make(map[string][2]*yaml.Node) // Key and value of each template
+	if block := mappingValue(doc, "templates"); block != nil && block.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(block.Content); i += 2 {
+			templates[block.Content[i].Value] = [2]*yaml.Node{block.Content[i], block.Content[i+1]}
+		}
+	}
+
+	workspaces := mappingValue(doc, "workspaces")
+	if workspaces == nil || workspaces.Kind != yaml.MappingNode {
+		removeMappingKey(doc, "templates")
+		return nil, nil
+	}
+
+	origins := make(map[*yaml.Node]string)
+
+	for i := 0; i+1 < len(workspaces.Content); i += 2 {
+		name, workspace := workspaces.Content[i], workspaces.Content[i+1]
+		use := mappingValue(workspace, "use")
+		if use == nil {
+			continue
+		}
+
+		template, found := templates[use.Value]
+		if !found {
+			return nil, NewTemplateError(ErrUnknownTemplate, use.Value, use)
+		}
+		key, body := template[0], template[1]
+
+		if mappingValue(body, "use") != nil {
+			return nil, NewTemplateError(ErrNestedTemplate, key.Value, key)
+		}
+
+		args, err := templateArgs(key.Value, body, mappingValue(workspace, "with"), use, s)
+		if err != nil {
+			return nil, err
+		}
+
+		instance := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: workspace.Line, Column: workspace.Column}
+		for j := 0; j+1 < len(body.Content); j += 2 {
+			field := body.Content[j].Value
+			if field == "params" || mappingValue(workspace, field) != nil {
+				continue
+			}
+			value := copyNode(body.Content[j+1], files)
+			substituteParams(value, args)
+			instance.Content = append(instance.Content, copyNode(body.Content[j], files), value)
+		}
+		instance.Content = append(instance.Content, workspace.Content...)
+
+		workspaces.Content[i+1] = instance
+		origins[name] = fmt.Sprintf("template '%s' at %s, used at %s", key.Value, files.position(key), files.position(use))
+	}
+
+	// Template values are only checked once instantiated
+	removeMappingKey(doc, "templates")
+
+	return origins, nil
+}
+
+// Returns the value of each parameter of a template for an instantiation
+func templateArgs(template string, body, with, use *yaml.Node, s *substitution) (map[string]string, error) {
+	params := make(map[string]*yaml.Node)
+	if block := mappingValue(body, "params"); block != nil {
+		for i := 0; i+1 < len(block.Content); i += 2 {
+			params[block.Content[i].Value] = block.Content[i+1]
+		}
+	}
+
+	args := make(map[string]string)
+
+	if with != nil {
+		if with.Kind != yaml.MappingNode {
+			return nil, NewTemplateError(ErrInvalidTemplateArgs, template, with)
+		}
+		for i := 0; i+1 < len(with.Content); i += 2 {
+			key, value := with.Content[i], with.Content[i+1]
+			if _, found := params[key.Value]; !found {
+				return nil, NewTemplateError(fmt.Errorf("%w: '%s'", ErrUnknownParam, key.Value), template, key)
+			}
+			if value.Kind != yaml.ScalarNode {
+				return nil, NewTemplateError(ErrInvalidTemplateArgs, template, value)
+			}
+			if err := s.substitute(value); err != nil {
+				return nil, err
+			}
+			args[key.Value] = value.Value
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(params)) {
+		if _, found := args[name]; found {
+			continue
+		}
+		if params[name].Tag == "!!null" {
+			return nil, NewTemplateError(fmt.Errorf("%w: '%s'", ErrMissingParam, name), template, use)
+		}
+		args[name] = params[name].Value
+	}
+
+	return args, nil
+}
+
+// Replaces the parameter references of the scalars under a node
+//
+// Other references are left for the variables.
+func substituteParams(node *yaml.Node, args map[string]string) {
+	if node.Kind == yaml.ScalarNode {
+		value := varRefRegex.ReplaceAllStringFunc(node.Value, func(ref string) string {
+			if ref == "$$" {
+				return ref
+			}
+			if value, found := args[varRefRegex.FindStringSubmatch(ref)[1]]; found {
+				return value
+			}
+			return ref
+		})
+
+		// Plain scalars are resolved again, so that a parameter can be a number
+		if value != node.Value && node.Style == 0 {
+			node.Tag = ""
+		}
+		node.Value = value
+		return
+	}
+
+	for _, child := range node.Content {
+		substituteParams(child, args)
+	}
+}
+
+// Removes a key and its value from a mapping node
+func removeMappingKey(node *yaml.Node, key string) {
+	if index := mappingIndex(node, key); index >= 0 {
+		node.Content = slices.Delete(node.Content, index, index+2)
+	}
+}
+
+// Deep copy of a node, keeping its position and file
+func copyNode(node *yaml.Node, files sources) *yaml.Node {
+	copied := *node
+	copied.Content = make([]*yaml.Node, len(node.Content))
+	for i, child := range node.Content {
+		copied.Content[i] = copyNode(child, files)
+	}
+
+	if file, found := files[node]; found {
+		files[&copied] = file
+	}
+	return &copied
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Parses a TOML document into YAML nodes, so that TOML configurations are
+// loaded like YAML ones
+//
+// Keys keep their order in the document. TOML decoding does not give the
+// position of values, so errors in a TOML configuration only point at its
+// file.
+func parseTOML(data []byte) (*yaml.Node, error) {
+	var value map[string]any
+	meta, err := toml.Decode(string(data), &value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTOML, err)
+	}
+
+	order := make(map[string]int)
+	for i, key := range meta.Keys() {
+		path := tomlPath(key)
+		if _, found := order[path]; !found {
+			order[path] = i
+		}
+	}
+
+	return tomlNode(value, nil, order), nil
+}
+
+// Layouts of TOML dates and times without an offset, by the zone they are
+// decoded in
+var tomlLocalLayouts = map[string]string{
+	"datetime-local": "2006-01-02T15:04:05.999999999",
+	"date-local":     "2006-01-02",
+	"time-local":     "15:04:05.999999999",
+}
+
+// Identifies a key, the items of arrays of tables sharing their keys
+func tomlPath(key []string) string {
+	return strings.Join(key, "\x00")
+}
+
+// Converts a decoded TOML value at a key into a YAML node
+func tomlNode(value any, key []string, order map[string]int) *yaml.Node {
+	switch v := value.(type) {
+	case map[string]any:
+		node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		prefix := ""
+		if len(key) > 0 {
+			prefix = tomlPath(key) + "\x00"
+		}
+		slices.SortFunc(names, func(a, b string) int {
+			return cmp.Compare(order[prefix+a], order[prefix+b])
+		})
+		for _, name := range names {
+			childKey := append(slices.Clone(key), name)
+			node.Content = append(node.Content, scalarNode("!!str", name), tomlNode(v[name], childKey, order))
+		}
+		return node
+	case []map[string]any:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, item := range v {
+			node.Content = append(node.Content, tomlNode(item, key, order))
+		}
+		return node
+	case []any:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, item := range v {
+			node.Content = append(node.Content, tomlNode(item, key, order))
+		}
+		return node
+	case string:
+		return scalarNode("!!str", v)
+	case int64:
+		return scalarNode("!!int", strconv.FormatInt(v, 10))
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			return scalarNode("!!float", ".nan")
+		case math.IsInf(v, 1):
+			return scalarNode("!!float", ".inf")
+		case math.IsInf(v, -1):
+			return scalarNode("!!float", "-.inf")
+		}
+		return scalarNode("!!float", strconv.FormatFloat(v, 'g', -1, 64))
+	case bool:
+		return scalarNode("!!bool", strconv.FormatBool(v))
+	case time.Time:
+		// No field holds a date, so they are kept as written
+		layout, found := tomlLocalLayouts[v.Location().String()]
+		if !found {
+			layout = time.RFC3339Nano
+		}
+		return scalarNode("!!str", v.Format(layout))
+	default:
+		return scalarNode("!!str", fmt.Sprint(v))
+	}
+}
+
+func scalarNode(tag string, value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value}
+}
@@ -0,0 +1,388 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Decodes a TOML document into generic values
+func decodeTOML(t *testing.T, src string) map[string]any {
+	t.Helper()
+
+	doc, err := parseTOML([]byte(src))
+	if err != nil {
+		t.Fatalf("parseTOML(%q): %v", src, err)
+	}
+
+	var value map[string]any
+	if err := doc.Decode(&value); err != nil {
+		t.Fatalf("decoding %q: %v", src, err)
+	}
+	return value
+}
+
+func TestParseTOMLValues(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want map[string]any
+	}{
+		{"empty", "", map[string]any{}},
+		{"comments and blank lines", "# comment\n\n  a = 1 # trailing\n", map[string]any{"a": 1}},
+		{"basic string", `a = "x y"`, map[string]any{"a": "x y"}},
+		{"escapes", `a = "q\" b\\ t\t n\n r\r e\e f\f b\b"`, map[string]any{"a": "q\" b\\ t\t n\n r\r e\x1b f\f b\b"}},
+		{"unicode escapes", `a = "\u00e9\U0001F600"`, map[string]any{"a": "é😀"}},
+		{"raw unicode", `a = "日本 ; , :"`, map[string]any{"a": "日本 ; , :"}},
+		{"literal string", `a = 'C:\path "q"'`, map[string]any{"a": `C:\path "q"`}},
+		{"empty strings", "a = \"\"\nb = ''", map[string]any{"a": "", "b": ""}},
+		{"multi-line basic", "a = \"\"\"\nline1\nline2\"\"\"", map[string]any{"a": "line1\nline2"}},
+		{"line ending backslash", "a = \"\"\"one \\\n    two\"\"\"", map[string]any{"a": "one two"}},
+		{"multi-line literal", "a = '''\nx\\n\n'y' '''", map[string]any{"a": "x\\n\n'y' "}},
+		{"crlf after multi-line opening", "a = \"\"\"\r\nx\"\"\"", map[string]any{"a": "x"}},
+		{"integers", "a = 42\nb = -7\nc = +3\nd = 1_000\ne = 0", map[string]any{"a": 42, "b": -7, "c": 3, "d": 1000, "e": 0}},
+		{"prefixed integers", "a = 0xff\nb = 0o17\nc = 0b101", map[string]any{"a": 255, "b": 15, "c": 5}},
+		{"floats", "a = 1.5\nb = -2e3\nc = 6.25E-2\nd = 1_0.5", map[string]any{"a": 1.5, "b": -2000.0, "c": 0.0625, "d": 10.5}},
+		{"infinities", "a = inf\nb = -inf\nc = +inf", map[string]any{"a": math.Inf(1), "b": math.Inf(-1), "c": math.Inf(1)}},
+		{"booleans", "a = true\nb = false", map[string]any{"a": true, "b": false}},
+		{"arrays", `a = [1, "two", [3, 4], []]`, map[string]any{"a": []any{1, "two", []any{3, 4}, []any{}}}},
+		{"multi-line array", "a = [\n  1, # one\n  2,\n]", map[string]any{"a": []any{1, 2}}},
+		{"inline tables", `a = { b = 1, c = { d = "e" } }`, map[string]any{"a": map[string]any{"b": 1, "c": map[string]any{"d": "e"}}}},
+		{"empty inline table", `a = {}`, map[string]any{"a": map[string]any{}}},
+		{"array of inline tables", `a = [{ b = 1 }, { b = 2 }]`, map[string]any{"a": []any{map[string]any{"b": 1}, map[string]any{"b": 2}}}},
+		{"dotted keys", "a.b.c = 1\na.d = 2", map[string]any{"a": map[string]any{"b": map[string]any{"c": 1}, "d": 2}}},
+		{"quoted keys", `"a b" = 1` + "\n" + `'c.d' = 2` + "\n" + `"e".f = 3`, map[string]any{"a b": 1, "c.d": 2, "e": map[string]any{"f": 3}}},
+		{"spaces around dots", "a . b = 1", map[string]any{"a": map[string]any{"b": 1}}},
+		{"tables", "[a]\nb = 1\n[a.c]\nd = 2\n[e]", map[string]any{"a": map[string]any{"b": 1, "c": map[string]any{"d": 2}}, "e": map[string]any{}}},
+		{"quoted table names", "[workspaces.\"1: web\"]\nlayout = \"h\"", map[string]any{"workspaces": map[string]any{"1: web": map[string]any{"layout": "h"}}}},
+		{"implicit table then explicit", "[a.b]\nc = 1\n[a]\nd = 2", map[string]any{"a": map[string]any{"b": map[string]any{"c": 1}, "d": 2}}},
+		{"arrays of tables", "[[a]]\nb = 1\n[[a]]\nb = 2", map[string]any{"a": []any{map[string]any{"b": 1}, map[string]any{"b": 2}}}},
+		{
+			"nested arrays of tables",
+			"[[w]]\nn = 1\n[[w.c]]\nx = 1\n[[w.c]]\nx = 2\n[w.h]\ny = 3\n[[w]]\nn = 2",
+			map[string]any{"w": []any{
+				map[string]any{"n": 1, "c": []any{map[string]any{"x": 1}, map[string]any{"x": 2}}, "h": map[string]any{"y": 3}},
+				map[string]any{"n": 2},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decodeTOML(t, tt.src); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseTOML(%q) = %#v, want %#v", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTOMLNaN(t *testing.T) {
+	got := decodeTOML(t, "a = nan\nb = -nan")
+	for _, key := range []string{"a", "b"} {
+		if f, ok := got[key].(float64); !ok || !math.IsNaN(f) {
+			t.Errorf("%s = %#v, want NaN", key, got[key])
+		}
+	}
+}
+
+func TestParseTOMLDates(t *testing.T) {
+	got := decodeTOML(t, "a = 1979-05-27\nb = 07:32:00\nc = 1979-05-27T07:32:00\nd = 1979-05-27T07:32:00-07:00")
+	want := map[string]any{"a": "1979-05-27", "b": "07:32:00", "c": "1979-05-27T07:32:00", "d": "1979-05-27T07:32:00-07:00"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseTOML() = %#v, want %#v", got, want)
+	}
+}
+
+// Keys keep their order in the document, as in YAML
+func TestParseTOMLKeyOrder(t *testing.T) {
+	src := "z = 1\na = 2\n[m]\ny = 1\nb = 2\n[[l]]\nq = 1\np = 2\n[[l]]\np = 1\nr = 2\nq = 3\n[c]\nx = 1"
+	doc, err := parseTOML([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := func(node *yaml.Node) []string {
+		var names []string
+		for i := 0; i < len(node.Content); i += 2 {
+			names = append(names, node.Content[i].Value)
+		}
+		return names
+	}
+	list := mappingValue(doc, "l")
+
+	tests := []struct {
+		name string
+		node *yaml.Node
+		want []string
+	}{
+		{"document", doc, []string{"z", "a", "m", "l", "c"}},
+		{"table", mappingValue(doc, "m"), []string{"y", "b"}},
+		{"first array table", list.Content[0], []string{"q", "p"}},
+		// Items of an array of tables share the order of keys first seen
+		{"later array table", list.Content[1], []string{"q", "p", "r"}},
+	}
+	for _, tt := range tests {
+		if got := keys(tt.node); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: keys %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		line int
+	}{
+		{"missing equals", "a 1", 1},
+		{"missing value", "a =", 1},
+		{"unterminated string", "a = \"x", 1},
+		{"newline in literal string", "\na = 'x\ny'", 2},
+		{"invalid escape", `a = "\q"`, 1},
+		{"duplicate key", "a = 1\nb = 2\na = 3", 3},
+		{"key redefined as table", "a = 1\n[a]", 2},
+		{"unclosed array", "a = [1, 2\nb = 1", 2},
+		{"leading zeros", "\n\na = 007", 3},
+		{"invalid number", "a = 1x", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseTOML([]byte(tt.src))
+			if !errors.Is(err, ErrInvalidTOML) {
+				t.Fatalf("parseTOML(%q) error = %v, want %v", tt.src, err, ErrInvalidTOML)
+			}
+			if line := fmt.Sprintf("line %d", tt.line); !strings.Contains(err.Error(), line) {
+				t.Errorf("parseTOML(%q) error = %q, want it at %s", tt.src, err, line)
+			}
+		})
+	}
+}
+
+// Errors in a TOML configuration point at its file
+func TestTOMLErrorPositions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	src := "[workspaces.dev]\nlayout = \"nope\"\n\n[[workspaces.dev.containers]]\napp = \"foot\"\n"
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := LoadConfig([]string{path}, LoadOptions{})
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) {
+		t.Fatalf("LoadConfig() error = %v, want a configuration error", err)
+	}
+	if configErr.Source != path {
+		t.Errorf("error source = %q, want %q", configErr.Source, path)
+	}
+}
+
+// Loads a configuration file with the given extension and contents
+func loadConfigFile(t *testing.T, ext, contents string) *Config {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config"+ext)
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig([]string{path}, LoadOptions{})
+	if err != nil {
+		t.Fatalf("loading %s configuration: %v", ext, err)
+	}
+	cfg.source = nil
+	return cfg
+}
+
+func TestTOMLMatchesYAML(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		toml string
+	}{
+		{
+			"workspace with containers",
+			`
+workspaces:
+  dev:
+    layout: splith
+    containers:
+      - app: foot
+        size: 50ppt
+        match:
+          app_id: foot
+      - app: firefox
+        delay: 2
+`,
+			`
+[workspaces.dev]
+layout = "splith"
+
+[[workspaces.dev.containers]]
+app = "foot"
+size = "50ppt"
+match.app_id = "foot"
+
+[[workspaces.dev.containers]]
+app = "firefox"
+delay = 2
+`,
+		},
+		{
+			"nested containers and quoting",
+			`
+focus: ["1: web", main]
+workspaces:
+  "1: web":
+    layout: v
+    containers:
+      - app: 'say "hi"; exit'
+        cmd: "printf '%s\\n' \"a\\\\b\""
+        env:
+          GREETING: "héllo, wörld"
+      - split: h
+        containers:
+          - app: chat
+            post: ["sway: floating enable", "wait: 1s"]
+          - app: mail
+  main:
+    layout: tabbed
+    containers:
+      - app: editor
+`,
+			`
+focus = ["1: web", "main"]
+
+[workspaces."1: web"]
+layout = "v"
+
+[[workspaces."1: web".containers]]
+app = 'say "hi"; exit'
+cmd = "printf '%s\\n' \"a\\\\b\""
+env = { GREETING = "h\u00e9llo, w\u00f6rld" }
+
+[[workspaces."1: web".containers]]
+split = "h"
+
+[[workspaces."1: web".containers.containers]]
+app = "chat"
+post = [
+  "sway: floating enable",
+  "wait: 1s",
+]
+
+[[workspaces."1: web".containers.containers]]
+app = "mail"
+
+[workspaces.main]
+layout = "tabbed"
+containers = [{ app = "editor" }]
+`,
+		},
+		{
+			"vars, hooks, scratchpad and variants",
+			`
+vars:
+  term: foot
+hooks:
+  before_all: [notify-send start]
+scratchpad:
+  notes:
+    app: ${term}
+    width: 50ppt
+workspaces:
+  code:
+    number: 2
+    name: code
+    layout: h
+    output: [DP-1, eDP-1]
+    containers:
+      - app: ${term}
+        id: term
+      - app: editor
+        depends_on: [term]
+    variants:
+      - when:
+          outputs: 1
+        layout: v
+`,
+			`
+vars.term = "foot"
+
+[hooks]
+before_all = ["notify-send start"]
+
+[scratchpad.notes]
+app = "${term}"
+width = "50ppt"
+
+[workspaces.code]
+number = 2
+name = "code"
+layout = "h"
+output = ["DP-1", "eDP-1"]
+
+[[workspaces.code.containers]]
+app = "${term}"
+id = "term"
+
+[[workspaces.code.containers]]
+app = "editor"
+depends_on = ["term"]
+
+[[workspaces.code.variants]]
+when.outputs = 1
+layout = "v"
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fromYAML := loadConfigFile(t, ".yml", tt.yaml)
+			fromTOML := loadConfigFile(t, ".toml", tt.toml)
+			if !reflect.DeepEqual(fromYAML, fromTOML) {
+				t.Errorf("TOML configuration differs from YAML:\nyaml: %#v\ntoml: %#v", fromYAML, fromTOML)
+			}
+		})
+	}
+}
+
+func FuzzParseTOML(f *testing.F) {
+	for _, seed := range []string{
+		"a = 1",
+		"[a.b]\nc = 'd'",
+		"[[a]]\nb = [1, {c = 2}]",
+		"a = \"\"\"\nx\\\n y\"\"\"",
+		"a = 0x1f\nb = -1.5e3\nc = inf",
+		"\"k\".'l' = true",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, src string) {
+		doc, err := parseTOML([]byte(src))
+		if err != nil {
+			if !errors.Is(err, ErrInvalidTOML) {
+				t.Fatalf("parseTOML(%q) error = %v, want %v", src, err, ErrInvalidTOML)
+			}
+			return
+		}
+		if doc.Kind != yaml.MappingNode {
+			t.Fatalf("parseTOML(%q) returned a %v node, want a mapping", src, doc.Kind)
+		}
+
+		// The document must be usable as a configuration document
+		var value map[string]any
+		if err := doc.Decode(&value); err != nil {
+			t.Fatalf("decoding parseTOML(%q): %v", src, err)
+		}
+	})
+}
@@ -0,0 +1,234 @@
+package config
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/titembaatar/sway.flem/internal/log"
+	"github.com/titembaatar/sway.flem/pkg/types"
+)
+
+// Command a configuration runs, shown before it is trusted
+type ConfigCommand struct {
+	Location string
+	Command  string
+}
+
+func (c ConfigCommand) String() string {
+	return fmt.Sprintf("%s: %s", c.Location, c.Command)
+}
+
+// Configuration that runs commands but is not trusted, or no longer is
+type UntrustedError struct {
+	Path     string
+	Changed  bool // Trusted before, with other contents
+	Commands []ConfigCommand
+}
+
+func (e *UntrustedError) Error() string {
+	if e.Changed {
+		return fmt.Sprintf("%v: %s changed since it was trusted", ErrUntrustedConfig, e.Path)
+	}
+	return fmt.Sprintf("%v: %s", ErrUntrustedConfig, e.Path)
+}
+
+func (e *UntrustedError) Unwrap() error {
+	return ErrUntrustedConfig
+}
+
+// Trusted configurations, by absolute path
+type TrustStore struct {
+	Configs map[string]TrustRecord `json:"configs"`
+
+	path string
+}
+
+// Trusted contents of a configuration file and of the files it includes
+type TrustRecord struct {
+	Hash      string    `json:"hash"`
+	TrustedAt time.Time `json:"trusted_at"`
+}
+
+// Returns the path of the trust store, under $XDG_STATE_HOME or
+// ~/.local/state
+func TrustStorePath() (string, error) {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "flem", "trust.json"), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find state directory: %w", err)
+	}
+	return filepath.Join(home, ".local", "state", "flem", "trust.json"), nil
+}
+
+// Loads the trust store, empty when it does not exist yet
+func LoadTrustStore() (*TrustStore, error) {
+	path, err := TrustStorePath()
+	if err != nil {
+		return nil, err
+	}
+
+	store := &TrustStore{Configs: make(map[string]TrustRecord), path: path}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trust store: %w", err)
+	}
+
+	if err := json.Unmarshal(data, store); err != nil {
+		return nil, fmt.Errorf("failed to parse trust store %s: %w", path, err)
+	}
+	if store.Configs == nil {
+		store.Configs = make(map[string]TrustRecord)
+	}
+	return store, nil
+}
+
+// Records a configuration as trusted with its current contents
+func (s *TrustStore) Trust(config *Config, path string) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	s.Configs[absPath] = TrustRecord{Hash: config.Hash(), TrustedAt: time.Now()}
+	return s.save()
+}
+
+// Writes the store, replacing the previous file at once
+func (s *TrustStore) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode trust store: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("failed to write trust store: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write trust store: %w", err)
+	}
+
+	log.Debug("Saved trust store %s", s.path)
+	return nil
+}
+
+// Checks that a configuration running commands was trusted with its current
+// contents, returning an *UntrustedError otherwise
+func (s *TrustStore) Check(config *Config, path string) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	commands := config.Commands()
+	if len(commands) == 0 {
+		log.Debug("Configuration %s runs no commands, no trust needed", absPath)
+		return nil
+	}
+
+	record, found := s.Configs[absPath]
+	if found && record.Hash == config.Hash() {
+		log.Debug("Configuration %s trusted since %s", absPath, record.TrustedAt.Format(time.DateTime))
+		return nil
+	}
+
+	return &UntrustedError{Path: path, Changed: found, Commands: commands}
+}
+
+// Hash of the files the configuration was loaded from, in order
+func (c *Config) Hash() string {
+	if c.source == nil {
+		return ""
+	}
+	return "sha256:" + hex.EncodeToString(c.source.digest.Sum(nil))
+}
+
+// Returns the commands the configuration runs: application launches, post
+// actions other than waits, hooks and readiness probes
+func (c *Config) Commands() []ConfigCommand {
+	var commands []ConfigCommand
+
+	addHooks := func(location string, hooks Hooks) {
+		for _, group := range []struct {
+			name  string
+			hooks []Hook
+		}{
+			{"before_all", hooks.BeforeAll},
+			{"after_all", hooks.AfterAll},
+			{"before_workspace", hooks.BeforeWorkspace},
+			{"after_workspace", hooks.AfterWorkspace},
+			{"on_failure", hooks.OnFailure},
+		} {
+			for _, hook := range group.hooks {
+				commands = append(commands, ConfigCommand{strings.TrimPrefix(location+" hooks."+group.name, " "), hook.Cmd})
+			}
+		}
+	}
+
+	var addContainers func(location string, containers []Container)
+	addContainer := func(location string, container Container) {
+		if len(container.Containers) > 0 {
+			addContainers(location+".containers", container.Containers)
+			return
+		}
+
+		cmd := container.Cmd
+		if cmd == "" {
+			cmd = container.App
+		}
+		commands = append(commands, ConfigCommand{location, cmd})
+
+		for _, entry := range container.Post {
+			if action, err := types.ParsePostAction(entry); err == nil && action.Kind != types.PostWait {
+				commands = append(commands, ConfigCommand{location + " post", action.String()})
+			}
+		}
+		if container.Ready.Cmd != "" {
+			commands = append(commands, ConfigCommand{location + " ready", container.Ready.Cmd})
+		}
+	}
+	addContainers = func(location string, containers []Container) {
+		for i, container := range containers {
+			addContainer(fmt.Sprintf("%s[%d]", location, i), container)
+		}
+	}
+
+	addHooks("", c.Hooks)
+
+	for _, name := range slices.Sorted(maps.Keys(c.Workspaces)) {
+		workspace := c.Workspaces[name]
+		location := fmt.Sprintf("workspace '%s'", name)
+
+		addHooks(location, workspace.Hooks)
+		addContainers(location+" container", workspace.Containers)
+		for i, variant := range workspace.Variants {
+			addContainers(fmt.Sprintf("%s variants[%d].container", location, i), variant.Containers)
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(c.Scratchpad)) {
+		addContainer(fmt.Sprintf("scratchpad.%s", name), c.Scratchpad[name])
+	}
+
+	return commands
+}
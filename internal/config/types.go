@@ -1,28 +1,227 @@
 package config
 
 import (
+	"strconv"
+	"strings"
+
 	"github.com/titembaatar/sway.flem/pkg/types"
+	"gopkg.in/yaml.v3"
 )
 
 // Configuration file
 type Config struct {
 	Workspaces map[string]Workspace `yaml:"workspaces" json:"workspaces"`
 	Focus      []string             `yaml:"focus" json:"focus"`
+	Hooks      Hooks                `yaml:"hooks" json:"hooks"`
+	Scratchpad map[string]Container `yaml:"scratchpad" json:"scratchpad"`
+	Vars       map[string]string    `yaml:"vars" json:"vars"` // Resolved variables once loaded
+	Apps       map[string]AppSpec   `yaml:"apps" json:"apps"`
+	Templates  map[string]Template  `yaml:"templates" json:"templates"` // Empty once loaded, as workspaces instantiate them
+	Include    Paths                `yaml:"include" json:"include"`     // Empty once loaded, as included files are merged
+
+	source   *configSource                // Merged files, for error messages
+	contexts map[string]map[string]string // Contexts of containers as written, by workspace, once guards removed some
 }
 
 // Workspace configuration
 type Workspace struct {
+	Number     int               `yaml:"number" json:"number"` // Number sway orders and switches to the workspace by
+	Name       string            `yaml:"name" json:"name"`     // Name in sway, after the number; the key by default
+	Layout     types.LayoutType  `yaml:"layout" json:"layout"`
+	Containers []Container       `yaml:"containers" json:"containers"`
+	Hooks      Hooks             `yaml:"hooks" json:"hooks"`
+	Output     Output            `yaml:"output" json:"output"`
+	Variants   []Variant         `yaml:"variants" json:"variants"`
+	When       string            `yaml:"when" json:"when"` // Guard expression, see ParseGuard
+	Use        string            `yaml:"use" json:"use"`   // Template the workspace instantiates
+	With       map[string]string `yaml:"with" json:"with"` // Arguments of the template
+
+	origin string // Template the workspace comes from, for error messages
+}
+
+// Returns the name of the workspace in sway, given its key in the
+// configuration: '<number>: <name>' for numbered workspaces, the name otherwise
+func (w Workspace) SwayName(key string) string {
+	name := w.Name
+	if name == "" {
+		name = key
+	}
+	if w.Number == 0 {
+		return name
+	}
+
+	number := strconv.Itoa(w.Number)
+	if name == number || strings.HasPrefix(name, number+":") {
+		return name
+	}
+	return number + ": " + name
+}
+
+// Alternative definition of a workspace, used when its condition holds
+//
+// Fields left empty are taken from the workspace.
+type Variant struct {
+	When       Condition        `yaml:"when" json:"when"`
 	Layout     types.LayoutType `yaml:"layout" json:"layout"`
 	Containers []Container      `yaml:"containers" json:"containers"`
+	Output     Output           `yaml:"output" json:"output"`
+}
+
+// Condition on the connected outputs
+//
+// The number of outputs is checked against all of them; the other criteria
+// must all hold for a single output, the one named by Output if set.
+type Condition struct {
+	Outputs     string `yaml:"outputs" json:"outputs"`         // Comparison on the number of outputs, e.g. '>=2'
+	Output      string `yaml:"output" json:"output"`           // Name of a connected output
+	Resolution  string `yaml:"resolution" json:"resolution"`   // Mode of the output, e.g. '3440x1440'
+	Width       string `yaml:"width" json:"width"`             // Comparison on the width of the mode
+	Height      string `yaml:"height" json:"height"`           // Comparison on the height of the mode
+	Orientation string `yaml:"orientation" json:"orientation"` // landscape or portrait
+	Scale       string `yaml:"scale" json:"scale"`             // Comparison on the scale
+}
+
+func (c Condition) IsEmpty() bool {
+	return c == Condition{}
+}
+
+// Whether the condition has criteria on a single output
+func (c Condition) HasOutputCriteria() bool {
+	rest := c
+	rest.Outputs = ""
+	return !rest.IsEmpty()
+}
+
+// Outputs a workspace is assigned to, in order of preference
+type Output []OutputMatch
+
+// Output criteria, by connector name or by make, model and serial as reported
+// by sway
+type OutputMatch struct {
+	Name   string `yaml:"name" json:"name"`
+	Make   string `yaml:"make" json:"make"`
+	Model  string `yaml:"model" json:"model"`
+	Serial string `yaml:"serial" json:"serial"`
+}
+
+// yaml.Unmarshaler interface, accepting a single output or a list, where
+// outputs are names or criteria
+func (o *Output) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.SequenceNode {
+		var match OutputMatch
+		if err := node.Decode(&match); err != nil {
+			return err
+		}
+		*o = Output{match}
+		return nil
+	}
+
+	type plain Output
+	return node.Decode((*plain)(o))
+}
+
+// yaml.Unmarshaler interface, accepting a plain output name
+func (m *OutputMatch) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		m.Name = node.Value
+		return nil
+	}
+
+	type plain OutputMatch
+	return node.Decode((*plain)(m))
+}
+
+// String representation of the criteria, for logs
+func (m OutputMatch) String() string {
+	var parts []string
+	for _, part := range []string{m.Name, m.Make, m.Model, m.Serial} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func (m OutputMatch) IsEmpty() bool {
+	return m.Name == "" && m.Make == "" && m.Model == "" && m.Serial == ""
+}
+
+// Commands run around the setup
+//
+// Workspaces only accept the before_workspace, after_workspace and on_failure
+// hooks, which run in addition to the top-level ones.
+type Hooks struct {
+	BeforeAll       []Hook `yaml:"before_all" json:"before_all"`
+	AfterAll        []Hook `yaml:"after_all" json:"after_all"`
+	BeforeWorkspace []Hook `yaml:"before_workspace" json:"before_workspace"`
+	AfterWorkspace  []Hook `yaml:"after_workspace" json:"after_workspace"`
+	OnFailure       []Hook `yaml:"on_failure" json:"on_failure"`
+}
+
+// Shell command run by a hook
+type Hook struct {
+	Cmd     string `yaml:"cmd" json:"cmd"`
+	Timeout int64  `yaml:"timeout" json:"timeout"` // Seconds, 0 for the default
+}
+
+// yaml.Unmarshaler interface, accepting a plain command string
+func (h *Hook) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		h.Cmd = node.Value
+		return nil
+	}
+
+	type plain Hook
+	return node.Decode((*plain)(h))
 }
 
 // Container in a workspace
 type Container struct {
-	App        string           `yaml:"app" json:"app"`
-	Cmd        string           `yaml:"cmd" json:"cmd"`
-	Size       string           `yaml:"size" json:"size"`
-	Delay      int64            `yaml:"delay" json:"delay"`
-	Post       []string         `yaml:"post" json:"post"`
-	Split      types.LayoutType `yaml:"split" json:"split"`
-	Containers []Container      `yaml:"containers" json:"containers"`
+	ID         string            `yaml:"id" json:"id"`
+	App        string            `yaml:"app" json:"app"`
+	Cmd        string            `yaml:"cmd" json:"cmd"`
+	Cwd        string            `yaml:"cwd" json:"cwd"` // Working directory of the application
+	Env        map[string]string `yaml:"env" json:"env"` // Extra environment of the application
+	Size       string            `yaml:"size" json:"size"`
+	Delay      int64             `yaml:"delay" json:"delay"`
+	Timeout    int64             `yaml:"timeout" json:"timeout"`
+	Post       []string          `yaml:"post" json:"post"`
+	Match      Match             `yaml:"match" json:"match"`
+	DependsOn  []string          `yaml:"depends_on" json:"depends_on"`
+	Ready      Probe             `yaml:"ready" json:"ready"`
+	Floating   bool              `yaml:"floating" json:"floating"`
+	Position   string            `yaml:"position" json:"position"`
+	Width      string            `yaml:"width" json:"width"`
+	Height     string            `yaml:"height" json:"height"`
+	When       string            `yaml:"when" json:"when"` // Guard expression, see ParseGuard
+	Split      types.LayoutType  `yaml:"split" json:"split"`
+	Containers []Container       `yaml:"containers" json:"containers"`
+}
+
+// Criteria identifying the window of an application, as regular expressions
+type Match struct {
+	AppID string `yaml:"app_id" json:"app_id"`
+	Class string `yaml:"class" json:"class"`
+	Title string `yaml:"title" json:"title"`
+}
+
+func (m Match) IsEmpty() bool {
+	return m.AppID == "" && m.Class == "" && m.Title == ""
+}
+
+// Check telling when a launched application is ready for its dependents
+//
+// Exactly one of the checks is set; it is retried until it succeeds or the
+// timeout is reached.
+type Probe struct {
+	TCP     int    `yaml:"tcp" json:"tcp"`         // Port accepting connections on localhost
+	Socket  string `yaml:"socket" json:"socket"`   // Unix socket accepting connections
+	File    string `yaml:"file" json:"file"`       // File that exists
+	Cmd     string `yaml:"cmd" json:"cmd"`         // Shell command that exits with status 0
+	Title   string `yaml:"title" json:"title"`     // Regular expression matching the window title
+	Timeout int64  `yaml:"timeout" json:"timeout"` // Seconds, 0 for the default
+}
+
+func (p Probe) IsEmpty() bool {
+	return p.TCP == 0 && p.Socket == "" && p.File == "" && p.Cmd == "" && p.Title == ""
 }
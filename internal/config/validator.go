@@ -1,19 +1,67 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/titembaatar/sway.flem/internal/log"
 	"github.com/titembaatar/sway.flem/pkg/types"
 )
 
 func ValidateConfig(config *Config) error {
-	if len(config.Workspaces) == 0 {
+	return config.locateError(validateConfig(config))
+}
+
+// Points a validation error at the file that introduced the value, and at
+// the template of instantiated workspaces
+func (c *Config) locateError(err error) error {
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) {
+		return err
+	}
+	configErr.Context = c.writtenContext(configErr.Workspace, configErr.Context)
+	if configErr.Source == "" && c.source != nil {
+		node := c.source.locate(configErr.Workspace, configErr.Context, configErr.Index)
+		configErr.Source = c.source.files.position(node)
+	}
+	if configErr.Origin == "" && configErr.Workspace != "" {
+		configErr.Origin = c.Workspaces[configErr.Workspace].origin
+	}
+	return err
+}
+
+// Context of a value as written in the configuration, whose containers may
+// have moved since guards removed some
+func (c *Config) writtenContext(workspaceName string, context string) string {
+	written := c.contexts[workspaceName]
+	for end := len(context); end > 0; end = strings.LastIndex(context[:end], ".") {
+		if prefix, found := written[context[:end]]; found {
+			return prefix + context[end:]
+		}
+	}
+	return context
+}
+
+func validateConfig(config *Config) error {
+	if len(config.Workspaces) == 0 && len(config.Scratchpad) == 0 {
 		return NewConfigError(ErrNoWorkspaces, "", "", -1)
 	}
 
 	log.Debug("Validating configuration with %d workspaces", len(config.Workspaces))
 
+	if err := resolveApps(config); err != nil {
+		return err
+	}
+
+	if err := validateHooks("", config.Hooks); err != nil {
+		return err
+	}
+
 	for name, workspace := range config.Workspaces {
 		layoutStr := string(workspace.Layout)
 		layout, err := types.ParseLayoutType(layoutStr)
@@ -31,6 +79,18 @@ func ValidateConfig(config *Config) error {
 		log.Debug("Workspace '%s' validated successfully", name)
 	}
 
+	if err := validateWorkspaceNames(config); err != nil {
+		return err
+	}
+
+	if err := validateDependencies(config); err != nil {
+		return err
+	}
+
+	if err := validateScratchpad(config); err != nil {
+		return err
+	}
+
 	log.Info("Configuration validated successfully")
 	return nil
 }
@@ -40,16 +100,169 @@ func validateWorkspace(name string, workspace Workspace) error {
 		return NewConfigError(types.ErrInvalidLayoutType, name, "", -1)
 	}
 
+	if workspace.Number < 0 {
+		return NewConfigError(ErrInvalidWorkspaceNumber, name, "number", -1)
+	}
+
 	if len(workspace.Containers) == 0 {
 		return NewConfigError(ErrNoContainers, name, "", -1)
 	}
 
+	if len(workspace.Hooks.BeforeAll) > 0 {
+		return NewConfigError(ErrHookNotAllowed, name, "hooks.before_all", -1)
+	}
+	if len(workspace.Hooks.AfterAll) > 0 {
+		return NewConfigError(ErrHookNotAllowed, name, "hooks.after_all", -1)
+	}
+	if err := validateHooks(name, workspace.Hooks); err != nil {
+		return err
+	}
+
+	for i, match := range workspace.Output {
+		if match.IsEmpty() {
+			return NewConfigError(ErrEmptyOutput, name, "output", i)
+		}
+	}
+
+	if err := validateGuard(workspace.When); err != nil {
+		return NewConfigError(err, name, "when", -1)
+	}
+
 	for i, container := range workspace.Containers {
 		if err := validateContainer(name, container, fmt.Sprintf("container[%d]", i)); err != nil {
 			return err
 		}
 	}
+	if err := validateSiblingSizes(name, workspace.Containers, "containers"); err != nil {
+		return err
+	}
+
+	for i := range workspace.Variants {
+		if err := validateVariant(name, &workspace.Variants[i], fmt.Sprintf("variants[%d]", i)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Checks that workspaces have distinct names in sway, and that numbered
+// workspaces have distinct numbers
+//
+// Sway considers any workspace whose name starts with a number as numbered,
+// so a number set with 'number' conflicts with such names too.
+func validateWorkspaceNames(config *Config) error {
+	names := make(map[string]string)
+	numbers := make(map[int]string)
+
+	for _, key := range slices.Sorted(maps.Keys(config.Workspaces)) {
+		workspace := config.Workspaces[key]
+		name := workspace.SwayName(key)
+
+		if other, found := names[name]; found {
+			return NewConfigError(fmt.Errorf("%w: '%s' by workspace '%s'", ErrDuplicateName, name, other), key, "name", -1)
+		}
+		names[name] = key
+
+		number := workspaceNumber(name)
+		if number < 0 {
+			continue
+		}
+		other, found := numbers[number]
+		if !found {
+			numbers[number] = key
+		} else if workspace.Number > 0 || config.Workspaces[other].Number > 0 {
+			return NewConfigError(fmt.Errorf("%w: %d by workspace '%s'", ErrDuplicateNumber, number, other), key, "number", -1)
+		}
+	}
+
+	return nil
+}
+
+// Number sway reads from the start of a workspace name, or -1
+func workspaceNumber(name string) int {
+	end := 0
+	for end < len(name) && '0' <= name[end] && name[end] <= '9' {
+		end++
+	}
+
+	number, err := strconv.Atoi(name[:end])
+	if err != nil {
+		return -1
+	}
+	return number
+}
+
+func validateVariant(workspaceName string, variant *Variant, context string) error {
+	if variant.Layout == "" && len(variant.Containers) == 0 && len(variant.Output) == 0 {
+		return NewConfigError(ErrEmptyVariant, workspaceName, context, -1)
+	}
+
+	if variant.Layout != "" {
+		layout, err := types.ParseLayoutType(string(variant.Layout))
+		if err != nil {
+			return NewConfigError(err, workspaceName, fmt.Sprintf("%s.layout", context), -1)
+		}
+		variant.Layout = layout
+	}
+
+	if err := validateCondition(variant.When); err != nil {
+		return NewConfigError(err, workspaceName, fmt.Sprintf("%s.when", context), -1)
+	}
+
+	for i, match := range variant.Output {
+		if match.IsEmpty() {
+			return NewConfigError(ErrEmptyOutput, workspaceName, fmt.Sprintf("%s.output", context), i)
+		}
+	}
+
+	for i, container := range variant.Containers {
+		if err := validateContainer(workspaceName, container, fmt.Sprintf("%s.container[%d]", context, i)); err != nil {
+			return err
+		}
+	}
+	if err := validateSiblingSizes(workspaceName, variant.Containers, fmt.Sprintf("%s.containers", context)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+var resolutionRegex = regexp.MustCompile(`^\d+x\d+$`)
+
+func validateCondition(condition Condition) error {
+	comparisons := []struct{ name, value string }{
+		{"outputs", condition.Outputs},
+		{"width", condition.Width},
+		{"height", condition.Height},
+		{"scale", condition.Scale},
+	}
+	for _, c := range comparisons {
+		if _, err := types.ParseComparison(c.value); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidCondition, c.name, err)
+		}
+	}
+
+	if condition.Resolution != "" && !resolutionRegex.MatchString(condition.Resolution) {
+		return fmt.Errorf("%w: resolution must be '<width>x<height>'", ErrInvalidCondition)
+	}
+
+	switch condition.Orientation {
+	case "", "landscape", "portrait":
+	default:
+		return fmt.Errorf("%w: orientation must be landscape or portrait", ErrInvalidCondition)
+	}
+
+	return nil
+}
 
+func validateGuard(expression string) error {
+	if strings.TrimSpace(expression) == "" {
+		return nil
+	}
+	if _, err := ParseGuard(expression); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidGuard, err)
+	}
 	return nil
 }
 
@@ -90,6 +303,350 @@ func validateContainerProperties(workspaceName string, container Container, cont
 		}
 	}
 
+	if container.Delay < 0 {
+		return NewConfigError(ErrNegativeDuration, workspaceName, fmt.Sprintf("%s.delay", context), -1)
+	}
+
+	if container.Timeout < 0 {
+		return NewConfigError(ErrNegativeDuration, workspaceName, fmt.Sprintf("%s.timeout", context), -1)
+	}
+
+	for i, entry := range container.Post {
+		if _, err := types.ParsePostAction(entry); err != nil {
+			return NewConfigError(err, workspaceName, fmt.Sprintf("%s.post", context), i)
+		}
+	}
+
+	for name := range container.Env {
+		if name == "" || strings.Contains(name, "=") {
+			return NewConfigError(fmt.Errorf("%w: '%s'", ErrInvalidEnv, name), workspaceName, fmt.Sprintf("%s.env", context), -1)
+		}
+	}
+
+	if err := validateGuard(container.When); err != nil {
+		return NewConfigError(err, workspaceName, fmt.Sprintf("%s.when", context), -1)
+	}
+
+	if container.ID != "" && !containerIDRegex.MatchString(container.ID) {
+		return NewConfigError(ErrInvalidID, workspaceName, fmt.Sprintf("%s.id", context), -1)
+	}
+
+	if container.App == "" && (len(container.DependsOn) > 0 || !container.Ready.IsEmpty()) {
+		return NewConfigError(ErrDependencyOnNested, workspaceName, context, -1)
+	}
+
+	if !container.Ready.IsEmpty() {
+		if err := validateProbe(container.Ready); err != nil {
+			return NewConfigError(err, workspaceName, fmt.Sprintf("%s.ready", context), -1)
+		}
+	}
+
+	if err := validateFloating(workspaceName, container, context); err != nil {
+		return err
+	}
+
+	if !container.Match.IsEmpty() {
+		if container.App == "" {
+			return NewConfigError(ErrMatchOnNestedContainer, workspaceName, fmt.Sprintf("%s.match", context), -1)
+		}
+		if err := validateMatch(container.Match); err != nil {
+			return NewConfigError(err, workspaceName, fmt.Sprintf("%s.match", context), -1)
+		}
+	}
+
+	return nil
+}
+
+func validateFloating(workspaceName string, container Container, context string) error {
+	if !container.Floating {
+		if container.Position != "" || container.Width != "" || container.Height != "" {
+			return NewConfigError(ErrFloatingOnly, workspaceName, context, -1)
+		}
+		return nil
+	}
+
+	if container.App == "" {
+		return NewConfigError(ErrFloatingOnNested, workspaceName, fmt.Sprintf("%s.floating", context), -1)
+	}
+
+	if container.Size != "" {
+		return NewConfigError(ErrSizeOnFloating, workspaceName, fmt.Sprintf("%s.size", context), -1)
+	}
+
+	dimensions := []struct{ name, value string }{
+		{"width", container.Width},
+		{"height", container.Height},
+	}
+	for _, d := range dimensions {
+		size, err := types.ParseSize(d.value)
+		if err != nil {
+			return NewConfigError(err, workspaceName, fmt.Sprintf("%s.%s", context, d.name), -1)
+		}
+		if !size.IsValid() {
+			return NewConfigError(types.ErrInvalidSizeFormat, workspaceName, fmt.Sprintf("%s.%s", context, d.name), -1)
+		}
+	}
+
+	if _, err := types.ParsePosition(container.Position); err != nil {
+		return NewConfigError(err, workspaceName, fmt.Sprintf("%s.position", context), -1)
+	}
+
+	return nil
+}
+
+func validateMatch(match Match) error {
+	criteria := map[string]string{
+		"app_id": match.AppID,
+		"class":  match.Class,
+		"title":  match.Title,
+	}
+
+	for name, pattern := range criteria {
+		if pattern == "" {
+			continue
+		}
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidMatch, name, err)
+		}
+	}
+
+	return nil
+}
+
+func validateProbe(probe Probe) error {
+	checks := 0
+	for _, set := range []bool{probe.TCP != 0, probe.Socket != "", probe.File != "", probe.Cmd != "", probe.Title != ""} {
+		if set {
+			checks++
+		}
+	}
+	if checks != 1 {
+		return ErrInvalidProbe
+	}
+
+	if probe.TCP < 0 || probe.TCP > 65535 {
+		return fmt.Errorf("%w: tcp port %d out of range", ErrInvalidProbe, probe.TCP)
+	}
+
+	if probe.Title != "" {
+		if _, err := regexp.Compile(probe.Title); err != nil {
+			return fmt.Errorf("%w: title: %v", ErrInvalidProbe, err)
+		}
+	}
+
+	if probe.Timeout < 0 {
+		return ErrNegativeDuration
+	}
+
+	return nil
+}
+
+// Checks the container ids and the dependencies between containers
+//
+// Dependencies within a workspace must point to containers launched earlier,
+// and workspaces must not depend on each other in a cycle, so that setting up
+// workspaces in dependency order never waits on a container yet to come.
+// Each variant with containers is checked as if it were selected, as its
+// containers replace those of its workspace.
+func validateDependencies(config *Config) error {
+	if err := validateDependencyGraph(config); err != nil {
+		return err
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(config.Workspaces)) {
+		workspace := config.Workspaces[name]
+		for i, variant := range workspace.Variants {
+			if len(variant.Containers) == 0 {
+				continue
+			}
+
+			resolved := *config
+			resolved.Workspaces = maps.Clone(config.Workspaces)
+			resolved.Workspaces[name] = workspace.WithVariant(i)
+			if err := validateDependencyGraph(&resolved); err != nil {
+				return inVariant(err, name, i)
+			}
+		}
+	}
+
+	return validateReferences(config, config.idWorkspaces())
+}
+
+// Points an error found with a variant selected at the containers of the
+// variant
+func inVariant(err error, workspaceName string, index int) error {
+	var configErr *ConfigError
+	if errors.As(err, &configErr) && configErr.Workspace == workspaceName && strings.HasPrefix(configErr.Context, "container") {
+		configErr.Context = fmt.Sprintf("variants[%d].%s", index, configErr.Context)
+	}
+	return err
+}
+
+// Checks the ids, dependencies and dependency cycles of the containers of
+// the workspaces, leaving their variants out
+func validateDependencyGraph(config *Config) error {
+	seen := make(map[string]string) // Workspace of each id
+
+	for _, name := range slices.Sorted(maps.Keys(config.Workspaces)) {
+		var err error
+		walkContainers(config.Workspaces[name].Containers, "container", func(context string, container Container) {
+			if err != nil || container.ID == "" {
+				return
+			}
+			if workspace, found := seen[container.ID]; found {
+				err = NewConfigError(
+					fmt.Errorf("%w: '%s' (first used in workspace '%s')", ErrDuplicateID, container.ID, workspace),
+					name, context+".id", -1)
+				return
+			}
+			seen[container.ID] = name
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	refs := config.ContainerIDs()
+	nested := make(map[string]bool)
+	for _, workspace := range config.Workspaces {
+		walkContainers(workspace.Containers, "container", func(_ string, container Container) {
+			if container.App == "" && container.ID != "" {
+				nested[container.ID] = true
+			}
+		})
+	}
+
+	graph := make(map[string][]string)
+
+	for _, name := range slices.Sorted(maps.Keys(config.Workspaces)) {
+		var err error
+		order := 0
+		walkContainers(config.Workspaces[name].Containers, "container", func(context string, container Container) {
+			if err != nil || container.App == "" {
+				return
+			}
+			defer func() { order++ }()
+
+			for i, id := range container.DependsOn {
+				ref, found := refs[id]
+				switch {
+				case !found && nested[id]:
+					err = fmt.Errorf("%w: '%s'", ErrNestedDependency, id)
+				case !found:
+					err = fmt.Errorf("%w: '%s'", ErrUnknownDependency, id)
+				case id == container.ID:
+					err = ErrSelfDependency
+				case ref.Workspace == name && ref.Order > order:
+					err = fmt.Errorf("%w: '%s'", ErrDependencyOrder, id)
+				}
+				if err != nil {
+					err = NewConfigError(err, name, context+".depends_on", i)
+					return
+				}
+			}
+
+			if container.ID != "" {
+				graph[container.ID] = container.DependsOn
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if cycle := findCycle(graph); cycle != nil {
+		ref := refs[cycle[0]]
+		return NewConfigError(fmt.Errorf("%w: %s", ErrDependencyCycle, formatCycle(cycle)),
+			ref.Workspace, ref.Context+".depends_on", -1)
+	}
+
+	if cycle := findCycle(config.WorkspaceDependencies()); cycle != nil {
+		return NewConfigError(fmt.Errorf("%w between workspaces: %s", ErrDependencyCycle, formatCycle(cycle)),
+			"", "", -1)
+	}
+
+	return nil
+}
+
+var containerIDRegex = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// Checks the container ids the focus list and post actions refer to
+func validateReferences(config *Config, ids map[string]string) error {
+	for i, entry := range config.Focus {
+		_, isWorkspace := config.Workspaces[entry]
+		if _, isID := ids[entry]; isID && isWorkspace {
+			return NewConfigError(fmt.Errorf("%w: '%s'", ErrAmbiguousFocus, entry), "", "focus", i)
+		}
+	}
+
+	checkPost := func(workspaceName string, context string, container Container) error {
+		for i, entry := range container.Post {
+			action, err := types.ParsePostAction(entry)
+			if err != nil || action.Target == "" {
+				continue
+			}
+			if _, found := ids[action.Target]; !found {
+				return NewConfigError(fmt.Errorf("%w: '%s'", ErrUnknownPostTarget, action.Target),
+					workspaceName, context+".post", i)
+			}
+		}
+		return nil
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(config.Workspaces)) {
+		workspace := config.Workspaces[name]
+		lists := map[string][]Container{"container": workspace.Containers}
+		for i, variant := range workspace.Variants {
+			lists[fmt.Sprintf("variants[%d].container", i)] = variant.Containers
+		}
+
+		for _, prefix := range slices.Sorted(maps.Keys(lists)) {
+			var err error
+			walkContainers(lists[prefix], prefix, func(context string, container Container) {
+				if err == nil {
+					err = checkPost(name, context, container)
+				}
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(config.Scratchpad)) {
+		if err := checkPost("", fmt.Sprintf("scratchpad.%s", name), config.Scratchpad[name]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+var scratchpadNameRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Checks the scratchpad entries, which are always floating
+func validateScratchpad(config *Config) error {
+	for name, container := range config.Scratchpad {
+		context := fmt.Sprintf("scratchpad.%s", name)
+
+		if !scratchpadNameRegex.MatchString(name) {
+			return NewConfigError(ErrInvalidScratchpadName, "", context, -1)
+		}
+		if container.App == "" || len(container.Containers) > 0 {
+			return NewConfigError(ErrScratchpadNotApp, "", context, -1)
+		}
+		if container.ID != "" || len(container.DependsOn) > 0 || !container.Ready.IsEmpty() {
+			return NewConfigError(ErrDependencyInScratchpad, "", context, -1)
+		}
+
+		container.Floating = true
+		config.Scratchpad[name] = container
+
+		if err := validateContainerProperties("", container, context); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -108,6 +665,10 @@ func validateNestedContainer(workspaceName string, container Container, context
 		return NewConfigError(types.ErrInvalidLayoutType, workspaceName, fmt.Sprintf("%s.split", context), -1)
 	}
 
+	if container.Containers[0].Floating {
+		return NewConfigError(ErrFloatingFirstChild, workspaceName, fmt.Sprintf("%s.containers[0]", context), -1)
+	}
+
 	// Note: This doesn't actually modify the original container since we're working on a copy
 	container.Split = layout
 
@@ -118,5 +679,63 @@ func validateNestedContainer(workspaceName string, container Container, context
 		}
 	}
 
+	return validateSiblingSizes(workspaceName, container.Containers, fmt.Sprintf("%s.containers", context))
+}
+
+// Checks that the sizes in ppt of the tiled containers sharing a parent fit
+// in it, leaving space for the siblings without a size
+//
+// Sizes in px depend on the output and are only fitted when applied.
+func validateSiblingSizes(workspaceName string, containers []Container, context string) error {
+	total, unsized := 0, 0
+	for _, container := range containers {
+		if container.Floating {
+			continue
+		}
+
+		// Validated along with the container
+		size, _ := types.ParseSize(container.Size)
+		switch {
+		case size.IsEmpty():
+			unsized++
+		case size.Unit == types.UnitPercent:
+			total += size.Value
+		}
+	}
+
+	if total > 100 {
+		return NewConfigError(fmt.Errorf("%w: %dppt", ErrSizeSumExceeded, total), workspaceName, context, -1)
+	}
+	if total == 100 && unsized > 0 {
+		return NewConfigError(ErrNoSpaceForSiblings, workspaceName, context, -1)
+	}
+
+	return nil
+}
+
+func validateHooks(workspaceName string, hooks Hooks) error {
+	stages := []struct {
+		name  string
+		hooks []Hook
+	}{
+		{"before_all", hooks.BeforeAll},
+		{"after_all", hooks.AfterAll},
+		{"before_workspace", hooks.BeforeWorkspace},
+		{"after_workspace", hooks.AfterWorkspace},
+		{"on_failure", hooks.OnFailure},
+	}
+
+	for _, stage := range stages {
+		context := fmt.Sprintf("hooks.%s", stage.name)
+		for i, hook := range stage.hooks {
+			if hook.Cmd == "" {
+				return NewConfigError(ErrEmptyHook, workspaceName, context, i)
+			}
+			if hook.Timeout < 0 {
+				return NewConfigError(ErrNegativeDuration, workspaceName, context+".timeout", i)
+			}
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/titembaatar/sway.flem/pkg/types"
+)
+
+// Application containers with the given sizes
+func sizedApps(sizes ...string) []Container {
+	containers := make([]Container, len(sizes))
+	for i, size := range sizes {
+		containers[i] = Container{App: "app", Size: size}
+	}
+	return containers
+}
+
+func TestValidateSiblingSizes(t *testing.T) {
+	floating := Container{App: "app", Size: "80ppt", Floating: true}
+
+	tests := []struct {
+		name       string
+		containers []Container
+		want       error
+	}{
+		{"no sizes", sizedApps("", ""), nil},
+		{"below 100", sizedApps("30ppt", "50", ""), nil},
+		{"exactly 100", sizedApps("30ppt", "70ppt"), nil},
+		{"exactly 100 without unit", sizedApps("50", "50"), nil},
+		{"exactly 100 with unsized", sizedApps("30ppt", "70ppt", ""), ErrNoSpaceForSiblings},
+		{"99 with unsized", sizedApps("30ppt", "69ppt", ""), nil},
+		{"above 100", sizedApps("60ppt", "50ppt"), ErrSizeSumExceeded},
+		{"single above 100", sizedApps("110ppt"), ErrSizeSumExceeded},
+		{"px ignored", sizedApps("60ppt", "40ppt", "800px"), nil},
+		{"px only", sizedApps("2000px", "3000px", ""), nil},
+		{"floating ignored", append(sizedApps("50ppt", "50ppt"), floating), nil},
+		{"floating not unsized", append(sizedApps("50ppt", "50ppt"), Container{App: "app", Floating: true}), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSiblingSizes("dev", tt.containers, "containers")
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("validateSiblingSizes() = %v, want no error", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("validateSiblingSizes() = %v, want %v", err, tt.want)
+			}
+
+			var configErr *ConfigError
+			if !errors.As(err, &configErr) || configErr.Workspace != "dev" || configErr.Context != "containers" {
+				t.Errorf("validateSiblingSizes() = %#v, want a ConfigError for workspace 'dev' and context 'containers'", err)
+			}
+		})
+	}
+}
+
+// Sizes of nested containers and variants are checked as those of the
+// workspace
+func TestValidateWorkspaceSiblingSizes(t *testing.T) {
+	nested := func(sizes ...string) Container {
+		return Container{Split: types.LayoutVertical, Containers: sizedApps(sizes...)}
+	}
+
+	tests := []struct {
+		name      string
+		workspace Workspace
+		context   string
+		want      error
+	}{
+		{
+			"workspace",
+			Workspace{Layout: types.LayoutHorizontal, Containers: sizedApps("50ppt", "50ppt", "")},
+			"containers",
+			ErrNoSpaceForSiblings,
+		},
+		{
+			"nested container",
+			Workspace{Layout: types.LayoutHorizontal, Containers: []Container{{App: "app"}, nested("70ppt", "40ppt")}},
+			"container[1].containers",
+			ErrSizeSumExceeded,
+		},
+		{
+			"nested container exactly 100",
+			Workspace{Layout: types.LayoutHorizontal, Containers: []Container{{App: "app"}, nested("70ppt", "30ppt")}},
+			"",
+			nil,
+		},
+		{
+			"variant",
+			Workspace{
+				Layout:     types.LayoutHorizontal,
+				Containers: sizedApps(""),
+				Variants:   []Variant{{Containers: sizedApps("100ppt", "")}},
+			},
+			"variants[0].containers",
+			ErrNoSpaceForSiblings,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateWorkspace("dev", tt.workspace)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("validateWorkspace() = %v, want no error", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("validateWorkspace() = %v, want %v", err, tt.want)
+			}
+
+			var configErr *ConfigError
+			if !errors.As(err, &configErr) || configErr.Context != tt.context {
+				t.Errorf("validateWorkspace() = %#v, want context '%s'", err, tt.context)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package config
+
+import "errors"
+
+// Returns the workspace with the fields set by one of its variants
+func (w Workspace) WithVariant(index int) Workspace {
+	variant := w.Variants[index]
+
+	if variant.Layout != "" {
+		w.Layout = variant.Layout
+	}
+	if len(variant.Containers) > 0 {
+		w.Containers = variant.Containers
+	}
+	if len(variant.Output) > 0 {
+		w.Output = variant.Output
+	}
+
+	w.Variants = nil
+	return w
+}
+
+// Whether a workspace of the configuration has variants
+func (c *Config) HasVariants() bool {
+	for _, workspace := range c.Workspaces {
+		if len(workspace.Variants) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns a copy of the configuration where workspaces use the variant
+// selected for them, by index, and their own definition otherwise
+//
+// Dependencies are checked again, as variants may change the containers, and
+// their errors point at the containers of the variants.
+func ApplyVariants(c *Config, selected map[string]int) (*Config, error) {
+	resolved := *c
+	resolved.Workspaces = make(map[string]Workspace, len(c.Workspaces))
+
+	for name, workspace := range c.Workspaces {
+		if index, found := selected[name]; found && index >= 0 {
+			workspace = workspace.WithVariant(index)
+		}
+		workspace.Variants = nil
+		resolved.Workspaces[name] = workspace
+	}
+
+	if err := validateDependencies(&resolved); err != nil {
+		var configErr *ConfigError
+		if errors.As(err, &configErr) {
+			name := configErr.Workspace
+			if index, found := selected[name]; found && index >= 0 && len(c.Workspaces[name].Variants[index].Containers) > 0 {
+				err = inVariant(err, name, index)
+			}
+		}
+		return nil, resolved.locateError(err)
+	}
+	return &resolved, nil
+}
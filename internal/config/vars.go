@@ -0,0 +1,355 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/titembaatar/sway.flem/internal/log"
+	"gopkg.in/yaml.v3"
+)
+
+// Prefix of the environment variables overriding configuration variables
+const VarEnvPrefix = "FLEM_VAR_"
+
+var (
+	varNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	// '$$' escapes a dollar sign, '${name}' refers to a variable
+	varRefRegex = regexp.MustCompile(`\$\$|\$\{([^}]*)\}`)
+)
+
+// Fields whose values are substituted, wherever they appear
+var substitutedFields = map[string]bool{
+	"cmd":  true,
+	"post": true,
+	"cwd":  true,
+}
+
+// Hook stages, whose hooks written as a plain command are substituted like
+// their cmd
+var hookFields = map[string]bool{
+	"before_all":       true,
+	"after_all":        true,
+	"before_workspace": true,
+	"after_workspace":  true,
+	"on_failure":       true,
+}
+
+// Variable error at a position of the configuration file
+type VarError struct {
+	Err    error
+	Name   string
+	File   string
+	Line   int
+	Column int
+
+	node *yaml.Node
+}
+
+func (e *VarError) Error() string {
+	position := formatPosition(e.File, e.Line, e.Column)
+	if position == "" {
+		return fmt.Sprintf("%v: '%s'", e.Err, e.Name)
+	}
+	return fmt.Sprintf("%s: %v: '%s'", position, e.Err, e.Name)
+}
+
+func (e *VarError) Unwrap() error {
+	return e.Err
+}
+
+func NewVarError(err error, name string, node *yaml.Node) *VarError {
+	varErr := &VarError{Err: err, Name: name, node: node}
+	if node != nil {
+		varErr.Line, varErr.Column = node.Line, node.Column
+	}
+	return varErr
+}
+
+// Position in a configuration file, for error messages
+func formatPosition(file string, line, column int) string {
+	// Values of TOML files have no position in them
+	if line == 0 {
+		return file
+	}
+	if file == "" {
+		return fmt.Sprintf("line %d, column %d", line, column)
+	}
+	return fmt.Sprintf("%s, line %d, column %d", file, line, column)
+}
+
+// Returns the variable overrides set in the environment, by name
+func EnvVars() map[string]string {
+	vars := make(map[string]string)
+	for _, entry := range os.Environ() {
+		if rest, found := strings.CutPrefix(entry, VarEnvPrefix); found {
+			if name, value, found := strings.Cut(rest, "="); found && name != "" {
+				vars[name] = value
+			}
+		}
+	}
+	return vars
+}
+
+// Resolves the variables of a configuration document
+//
+// Variables come from the vars block, then the environment, then the
+// overrides, the last definition of a name winning. Values of the vars block
+// may refer to other variables.
+func newSubstitution(doc *yaml.Node, overrides map[string]string) (*substitution, error) {
+	s := &substitution{
+		raw:      make(map[string]*yaml.Node),
+		resolved: make(map[string]string),
+	}
+
+	if block := mappingValue(doc, "vars"); block != nil {
+		if block.Kind != yaml.MappingNode {
+			return nil, NewVarError(ErrInvalidVars, "vars", block)
+		}
+		for i := 0; i+1 < len(block.Content); i += 2 {
+			key, value := block.Content[i], block.Content[i+1]
+			if !varNameRegex.MatchString(key.Value) {
+				return nil, NewVarError(ErrInvalidVarName, key.Value, key)
+			}
+			if value.Kind != yaml.ScalarNode {
+				return nil, NewVarError(ErrInvalidVars, key.Value, value)
+			}
+			s.raw[key.Value] = value
+		}
+	}
+
+	for _, source := range []map[string]string{EnvVars(), overrides} {
+		for name, value := range source {
+			if !varNameRegex.MatchString(name) {
+				return nil, NewVarError(ErrInvalidVarName, name, nil)
+			}
+			delete(s.raw, name)
+			s.resolved[name] = value
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(s.raw)) {
+		if _, err := s.resolve(name, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(s.resolved)) {
+		log.Debug("Variable %s = %s", name, s.resolved[name])
+	}
+	return s, nil
+}
+
+// Replaces the variable references of a configuration document
+//
+// The vars and templates blocks are left alone: templates are substituted
+// once instantiated in workspaces.
+func (s *substitution) substituteDocument(doc *yaml.Node) error {
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		key, value := doc.Content[i], doc.Content[i+1]
+
+		var err error
+		switch key.Value {
+		case "vars", "templates":
+			continue
+		case "workspaces":
+			err = s.substituteKeys(value)
+			for j := 1; err == nil && j < len(value.Content); j += 2 {
+				if name := mappingValue(value.Content[j], "name"); name != nil {
+					err = s.substituteScalars(name)
+				}
+			}
+		case "focus":
+			err = s.substituteScalars(value)
+		}
+		if err == nil {
+			err = s.substituteFields(value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Variables being resolved
+type substitution struct {
+	raw      map[string]*yaml.Node // Values of the vars block not resolved yet
+	resolved map[string]string
+}
+
+// Resolves a variable of the vars block, following references to others
+func (s *substitution) resolve(name string, stack []string) (string, error) {
+	if value, found := s.resolved[name]; found {
+		return value, nil
+	}
+
+	node := s.raw[name]
+	if slices.Contains(stack, name) {
+		cycle := strings.Join(append(stack, name), " -> ")
+		return "", NewVarError(ErrVarCycle, cycle, node)
+	}
+
+	value, err := s.expand(node.Value, node, func(ref string) (string, bool, error) {
+		if _, found := s.raw[ref]; !found {
+			value, found := s.lookup(ref)
+			return value, found, nil
+		}
+		value, err := s.resolve(ref, append(stack, name))
+		return value, true, err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	s.resolved[name] = value
+	delete(s.raw, name)
+	return value, nil
+}
+
+// Value of a resolved variable, or of the environment variable of that name
+// for names that are not variables, such as ${HOME}
+func (s *substitution) lookup(name string) (string, bool) {
+	if value, found := s.resolved[name]; found {
+		return value, true
+	}
+	return os.LookupEnv(name)
+}
+
+// Replaces the references of a string, looked up with lookup
+func (s *substitution) expand(text string, node *yaml.Node, lookup func(string) (string, bool, error)) (string, error) {
+	var err error
+
+	expanded := varRefRegex.ReplaceAllStringFunc(text, func(ref string) string {
+		if err != nil {
+			return ""
+		}
+		if ref == "$$" {
+			return "$"
+		}
+
+		name := varRefRegex.FindStringSubmatch(ref)[1]
+		value, found, lookupErr := lookup(name)
+		switch {
+		case lookupErr != nil:
+			err = lookupErr
+		case !found:
+			err = NewVarError(ErrUndefinedVar, name, node)
+		}
+		return value
+	})
+
+	return expanded, err
+}
+
+// Replaces the references of a scalar node in place
+func (s *substitution) substitute(node *yaml.Node) error {
+	if node.Kind != yaml.ScalarNode {
+		return nil
+	}
+
+	value, err := s.expand(node.Value, node, func(name string) (string, bool, error) {
+		value, found := s.lookup(name)
+		return value, found, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	node.Value = value
+	return nil
+}
+
+// Replaces the references of the items of a sequence
+func (s *substitution) substituteScalars(node *yaml.Node) error {
+	if node.Kind != yaml.SequenceNode {
+		return s.substitute(node)
+	}
+	for _, item := range node.Content {
+		if err := s.substitute(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Replaces the references of the keys of a mapping, which must stay unique
+func (s *substitution) substituteKeys(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	for i := 0; i < len(node.Content); i += 2 {
+		key := node.Content[i]
+		if err := s.substitute(key); err != nil {
+			return err
+		}
+		if seen[key.Value] {
+			return NewVarError(ErrDuplicateName, key.Value, key)
+		}
+		seen[key.Value] = true
+	}
+	return nil
+}
+
+// Replaces the references of the substituted fields found under a node
+func (s *substitution) substituteFields(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+
+			var err error
+			switch {
+			case substitutedFields[key.Value]:
+				err = s.substituteScalars(value)
+			case hookFields[key.Value] && value.Kind == yaml.SequenceNode:
+				for _, hook := range value.Content {
+					if err == nil {
+						err = s.substitute(hook)
+					}
+				}
+				if err == nil {
+					err = s.substituteFields(value)
+				}
+			default:
+				err = s.substituteFields(value)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			if err := s.substituteFields(item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Value of a key of a mapping node, or nil
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if index := mappingIndex(node, key); index >= 0 {
+		return node.Content[index+1]
+	}
+	return nil
+}
+
+// Index of a key in the content of a mapping node, or -1
+func mappingIndex(node *yaml.Node, key string) int {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return -1
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,126 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Loads a YAML configuration expected to fail
+func loadConfigError(t *testing.T, contents string) error {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := LoadConfig([]string{path}, LoadOptions{})
+	if err == nil {
+		t.Fatalf("LoadConfig() succeeded, want an error")
+	}
+	return err
+}
+
+func TestSubstitution(t *testing.T) {
+	t.Setenv("FLEM_TEST_DIR", "/home/flem")
+	t.Setenv("FLEM_TEST_TERM", "alacritty")
+
+	cfg := loadConfigFile(t, ".yml", `
+vars:
+  src: ${FLEM_TEST_DIR}/src
+  FLEM_TEST_TERM: foot
+hooks:
+  before_all:
+    - echo ${src}
+    - cmd: echo ${src}
+      timeout: 5
+  on_failure: ["echo ${FLEM_TEST_DIR}"]
+workspaces:
+  dev:
+    layout: h
+    hooks:
+      before_workspace: ["echo ${src}"]
+      after_workspace:
+        - cmd: echo ${FLEM_TEST_DIR}
+    containers:
+      - app: editor
+        cmd: ${FLEM_TEST_TERM} -e nvim
+        cwd: ${FLEM_TEST_DIR}/src
+        post: ["exec: echo $${HOME} ${src}"]
+        ready:
+          cmd: test -d ${src}
+`)
+
+	dev := cfg.Workspaces["dev"]
+	container := dev.Containers[0]
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"variable from the environment", cfg.Vars["src"], "/home/flem/src"},
+		{"variable over the environment", container.Cmd, "foot -e nvim"},
+		{"cwd from the environment", container.Cwd, "/home/flem/src"},
+		{"escaped dollar", container.Post[0], "exec: echo ${HOME} /home/flem/src"},
+		{"probe", container.Ready.Cmd, "test -d /home/flem/src"},
+		{"plain hook", cfg.Hooks.BeforeAll[0].Cmd, "echo /home/flem/src"},
+		{"hook cmd", cfg.Hooks.BeforeAll[1].Cmd, "echo /home/flem/src"},
+		{"plain hook from the environment", cfg.Hooks.OnFailure[0].Cmd, "echo /home/flem"},
+		{"plain workspace hook", dev.Hooks.BeforeWorkspace[0].Cmd, "echo /home/flem/src"},
+		{"workspace hook cmd", dev.Hooks.AfterWorkspace[0].Cmd, "echo /home/flem"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestSubstitutionErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		want     error
+		position string
+	}{
+		{
+			"undefined in cwd",
+			"workspaces:\n  dev:\n    layout: h\n    containers:\n      - app: editor\n        cwd: ${FLEM_TEST_UNSET}/src\n",
+			ErrUndefinedVar,
+			"line 6",
+		},
+		{
+			"undefined in plain hook",
+			"hooks:\n  before_all:\n    - echo ${FLEM_TEST_UNSET}\nworkspaces:\n  dev:\n    layout: h\n    containers:\n      - app: editor\n",
+			ErrUndefinedVar,
+			"line 3",
+		},
+		{
+			"undefined in hook cmd",
+			"hooks:\n  after_all:\n    - cmd: echo ${FLEM_TEST_UNSET}\nworkspaces:\n  dev:\n    layout: h\n    containers:\n      - app: editor\n",
+			ErrUndefinedVar,
+			"line 3",
+		},
+		{
+			"cycle",
+			"vars:\n  a: ${b}\n  b: ${a}\nworkspaces:\n  dev:\n    layout: h\n    containers:\n      - app: editor\n",
+			ErrVarCycle,
+			"line 2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := loadConfigError(t, tt.contents)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("LoadConfig() error = %v, want %v", err, tt.want)
+			}
+			if !strings.Contains(err.Error(), tt.position) {
+				t.Errorf("LoadConfig() error = %q, want it at %s", err, tt.position)
+			}
+		})
+	}
+}
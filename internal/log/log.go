@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -20,6 +21,9 @@ const (
 var (
 	currentLevel = LogLevelInfo
 	Component    = ""
+
+	// Guards Component and serializes output, as setup runs concurrently
+	mu sync.Mutex
 )
 
 const (
@@ -38,6 +42,8 @@ func GetLevel() LogLevel {
 }
 
 func SetComponent(component string) {
+	mu.Lock()
+	defer mu.Unlock()
 	Component = strings.ToUpper(component)
 }
 
@@ -106,6 +112,9 @@ func logMessage(level string, format string, args ...any) {
 	timestamp := time.Now().Format("2006-01-02 15:04:05")
 	message := fmt.Sprintf(format, args...)
 
+	mu.Lock()
+	defer mu.Unlock()
+
 	if Component != "" {
 		fmt.Fprintf(os.Stderr, "[%s] [%s] [%s]: %s\n", timestamp, level, Component, message)
 	} else {
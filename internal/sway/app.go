@@ -1,9 +1,15 @@
 package sway
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
+	"regexp"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/titembaatar/sway.flem/internal/config"
@@ -11,96 +17,332 @@ import (
 	"github.com/titembaatar/sway.flem/pkg/types"
 )
 
-type AppInfo struct {
-	Mark   string
-	Size   string
-	Layout string
+// Time to wait for the window of an application when none is configured
+const defaultWindowTimeout = 10 * time.Second
+
+// How a launched application is waited for and marked
+type LaunchOptions struct {
+	// Wait for the configured delay before looking for the window
+	WaitDelay bool
+	// Mark the focused window when no window of the launched process appears
+	AllowFocusMark bool
+	// Move marks already set on other containers instead of failing
+	ReplaceMarks bool
+	// Workspace the application is launched for, exposed to post actions
+	Workspace string
+	// Leave the floating geometry to the caller, which places the window first
+	DeferFloating bool
 }
 
-// Launches an application and marks it
-func LaunchApp(app config.Container, markID string) error {
+// Launches an application and marks its window
+//
+// The window is the first new one owned by the launched process tree and
+// matching the container criteria, or only matching them when the container
+// has criteria, and is marked by its container ID, so a popup or another
+// application grabbing focus does not get the mark.
+func LaunchApp(ctx context.Context, app config.Container, mark Mark, opts LaunchOptions) (*Node, error) {
 	log.Info("Launching application: %s", app.App)
-	mark := NewMark(markID)
 
 	cmdStr := app.Cmd
 	if cmdStr == "" {
 		cmdStr = app.App
 	}
 
+	known, err := listWindows(ctx)
+	if err != nil {
+		return nil, NewAppLaunchError(app.App, cmdStr, err)
+	}
+
 	// Execute the command to launch the app
-	if err := executeCommand(cmdStr); err != nil {
+	cmd, err := startCommand(ctx, cmdStr, config.ExpandPath(app.Cwd), app.Environ())
+	if err != nil {
 		log.Error("Failed to start application '%s' with command '%s': %v", app.App, cmdStr, err)
-		return NewAppLaunchError(app.App, cmdStr, err)
+		return nil, NewAppLaunchError(app.App, cmdStr, err)
 	}
 
-	log.Debug("Application '%s' launched, waiting for it to initialize", app.App)
+	log.Debug("Application '%s' launched with pid %d, waiting for its window", app.App, cmd.Process.Pid)
 
 	// Give the application some time to launch
-	if app.Delay != 0 {
-		time.Sleep(time.Duration(app.Delay) * time.Second)
-	} else {
-		time.Sleep(300 * time.Millisecond)
+	if opts.WaitDelay {
+		delay := 300 * time.Millisecond
+		if app.Delay != 0 {
+			delay = time.Duration(app.Delay) * time.Second
+		}
+		if err := sleep(ctx, delay); err != nil {
+			return nil, NewAppLaunchError(app.App, cmdStr, err)
+		}
+	}
+
+	window, err := findAppWindow(ctx, app, cmd.Process.Pid, known, opts.AllowFocusMark)
+	if err != nil {
+		return nil, NewAppLaunchError(app.App, cmdStr, err)
 	}
 
 	// Apply mark to the application
-	log.Debug("Applying mark '%s' to application", mark.String())
-	if err := mark.Apply(); err != nil {
+	log.Debug("Applying mark '%s' to window %d", mark.String(), window.ID)
+	if err := mark.ApplyTo(ctx, window.ID, opts.ReplaceMarks); err != nil {
 		log.Error("Failed to apply mark '%s' to application '%s': %v", mark.String(), app.App, err)
-		return NewMarkError(mark.String(), fmt.Errorf("%w: %v", ErrMarkingFailed, err))
+		return window, err
+	}
+
+	if app.Floating && !opts.DeferFloating {
+		if err := applyFloating(ctx, mark, app); err != nil {
+			if ctx.Err() != nil {
+				return window, ctx.Err()
+			}
+			log.Warn("Failed to apply floating geometry to '%s': %v", app.App, err)
+		}
 	}
 
-	// Execute post-launch commands if any
+	// Execute post-launch actions if any
 	if len(app.Post) > 0 {
-		log.Debug("Executing %d post-launch commands for '%s'", len(app.Post), app.App)
-		if err := RunPostCmd(app.Post); err != nil {
-			log.Warn("Some post-launch commands failed for '%s': %v", app.App, err)
-			// Continue execution even if post commands fail
+		log.Debug("Executing %d post-launch actions for '%s'", len(app.Post), app.App)
+		target := PostTarget{
+			Mark:      mark,
+			ID:        app.ID,
+			ConID:     window.ID,
+			PID:       window.PID,
+			AppID:     window.AppID,
+			Workspace: opts.Workspace,
+			Dir:       config.ExpandPath(app.Cwd),
+		}
+		if err := RunPostActions(ctx, app.Post, target); err != nil {
+			if ctx.Err() != nil {
+				return window, ctx.Err()
+			}
+			log.Warn("Some post-launch actions failed for '%s': %v", app.App, err)
+			// Continue execution even if post actions fail
 		}
 	}
 
 	log.Info("Successfully launched application '%s' with mark '%s'", app.App, mark.String())
-	return nil
+	return window, nil
+}
+
+// Returns the IDs of the windows currently in the tree
+func listWindows(ctx context.Context) (map[int64]bool, error) {
+	tree, err := GetTree(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	windows := make(map[int64]bool)
+	tree.Find(func(n *Node) bool {
+		if n.IsWindow() {
+			windows[n.ID] = true
+		}
+		return false
+	})
+	return windows, nil
+}
+
+// Windows taken by launches, so that two launches never take the same window
+var claimedWindows = struct {
+	sync.Mutex
+	ids map[int64]bool
+}{ids: make(map[int64]bool)}
+
+// Takes a window for a launch, returning false when another launch has it
+func claimWindow(id int64) bool {
+	claimedWindows.Lock()
+	defer claimedWindows.Unlock()
+
+	if claimedWindows.ids[id] {
+		return false
+	}
+	claimedWindows.ids[id] = true
+	return true
+}
+
+// Whether a new window may belong to a launched application
+//
+// Windows must match the container criteria and belong to the process tree of
+// pid, unless the container has criteria: single-instance and client/server
+// applications (e.g. firefox with a running instance, footclient or
+// emacsclient) have their windows created by another process.
+func acceptsWindow(n *Node, app config.Container, pid int) bool {
+	if !matchesCriteria(n, app.Match) {
+		return false
+	}
+	return !app.Match.IsEmpty() || inProcessTree(n.PID, pid)
+}
+
+// Waits for the window of a launched application
+//
+// Only new windows accepted by acceptsWindow and not taken by another launch
+// are considered. When allowed, the focused window is used as a last resort,
+// provided it matches the container criteria.
+func findAppWindow(ctx context.Context, app config.Container, pid int, known map[int64]bool, allowFocus bool) (*Node, error) {
+	timeout := defaultWindowTimeout
+	if app.Timeout != 0 {
+		timeout = time.Duration(app.Timeout) * time.Second
+	}
+
+	window, err := WaitForWindow(ctx, func(n *Node) bool {
+		return !known[n.ID] && acceptsWindow(n, app, pid) && claimWindow(n.ID)
+	}, timeout)
+	if err == nil {
+		if inProcessTree(window.PID, pid) {
+			log.Debug("Window %d of '%s' verified to belong to process %d", window.ID, app.App, pid)
+		} else {
+			log.Debug("Window %d of '%s' identified by its criteria, owned by process %d", window.ID, app.App, window.PID)
+		}
+		return window, nil
+	}
+
+	if !allowFocus || !errors.Is(err, ErrWindowTimeout) {
+		return nil, err
+	}
+
+	log.Warn("No window of process %d found for '%s', falling back to the focused window", pid, app.App)
+
+	tree, treeErr := GetTree(ctx)
+	if treeErr != nil {
+		return nil, treeErr
+	}
+
+	focused := tree.Find(func(n *Node) bool {
+		return n.Focused && n.IsWindow()
+	})
+	if focused == nil || !matchesCriteria(focused, app.Match) {
+		return nil, fmt.Errorf("%w: focused window does not match '%s'", err, app.App)
+	}
+	if !claimWindow(focused.ID) {
+		return nil, fmt.Errorf("%w: focused window was taken by another application", err)
+	}
+
+	return focused, nil
+}
+
+// Whether a window matches the criteria of a container
+func matchesCriteria(n *Node, match config.Match) bool {
+	class, title := "", n.Name
+	if n.WindowProperties != nil {
+		class = n.WindowProperties.Class
+	}
+
+	criteria := []struct{ pattern, value string }{
+		{match.AppID, n.AppID},
+		{match.Class, class},
+		{match.Title, title},
+	}
+
+	for _, c := range criteria {
+		if c.pattern == "" {
+			continue
+		}
+		// Patterns are checked by the config validator
+		if matched, err := regexp.MatchString(c.pattern, c.value); err != nil || !matched {
+			return false
+		}
+	}
+
+	return true
 }
 
-// Executes post-launch commands
-func RunPostCmd(commands []string) error {
-	if len(commands) == 0 {
+// Window a post action applies to
+type PostTarget struct {
+	Mark      Mark
+	ID        string // Id of the container, if any
+	ConID     int64
+	PID       int
+	AppID     string
+	Workspace string
+	Dir       string // Working directory of exec actions
+}
+
+// Environment passed to exec post actions
+func (t PostTarget) Env() []string {
+	return []string{
+		"FLEM_MARK=" + t.Mark.String(),
+		"FLEM_ID=" + t.ID,
+		fmt.Sprintf("FLEM_CON_ID=%d", t.ConID),
+		fmt.Sprintf("FLEM_PID=%d", t.PID),
+		"FLEM_APP_ID=" + t.AppID,
+		"FLEM_WORKSPACE=" + t.Workspace,
+	}
+}
+
+// Runs post-launch actions against the launched window
+//
+// Sway actions are run with the window mark as criteria, or the mark of the
+// container they target, exec actions are
+// started as processes with the window details in their environment, and wait
+// actions pause before the next one.
+func RunPostActions(ctx context.Context, entries []string, target PostTarget) error {
+	if len(entries) == 0 {
 		return nil
 	}
 
-	log.Info("Executing %d post-launch commands", len(commands))
+	log.Info("Executing %d post-launch actions", len(entries))
 	var errors []string
 
-	for i, cmdStr := range commands {
-		log.Debug("Executing post-launch command %d: %s", i+1, cmdStr)
-
-		err := executeCommand(cmdStr)
+	for i, entry := range entries {
+		action, err := types.ParsePostAction(entry)
 		if err != nil {
-			log.Error("Failed to execute post-launch command %d: %v", i+1, err)
-			errors = append(errors, fmt.Sprintf("command %d: %v", i+1, err))
+			log.Error("Invalid post-launch action %d: %v", i+1, err)
+			errors = append(errors, fmt.Sprintf("action %d: %v", i+1, err))
 			continue
 		}
 
-		time.Sleep(200 * time.Millisecond)
+		log.Debug("Executing post-launch action %d: %s", i+1, action)
+
+		switch action.Kind {
+		case types.PostWait:
+			err = sleep(ctx, action.Wait)
+		case types.PostSway:
+			mark := target.Mark
+			if action.Target != "" {
+				mark = NewIDMark(action.Target)
+			}
+			// The command itself comes from the configuration, as sway syntax
+			_, err = RunCommand(ctx, mark.Command(action.Command).String())
+		default:
+			if err = executeCommand(ctx, action.Command, target.Dir, target.Env()); err == nil {
+				err = sleep(ctx, 200*time.Millisecond)
+			}
+		}
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Error("Failed to execute post-launch action %d: %v", i+1, err)
+			errors = append(errors, fmt.Sprintf("action %d: %v", i+1, err))
+		}
 	}
 
 	if len(errors) > 0 {
-		return fmt.Errorf("failed to execute some post-launch commands: %s", strings.Join(errors, "; "))
+		return fmt.Errorf("failed to execute some post-launch actions: %s", strings.Join(errors, "; "))
 	}
 
-	log.Info("All post-launch commands executed successfully")
+	log.Info("All post-launch actions executed successfully")
 	return nil
 }
 
 // Parses and executes a command string
-func executeCommand(cmdStr string) error {
+//
+// The context only guards the start of the process: launched applications are
+// meant to outlive flem, so they are not killed when the context is cancelled.
+func executeCommand(ctx context.Context, cmdStr string, dir string, env []string) error {
+	_, err := startCommand(ctx, cmdStr, dir, env)
+	return err
+}
+
+// Starts a command string in a directory, the current one when empty, with
+// extra environment variables and returns the running process
+func startCommand(ctx context.Context, cmdStr string, dir string, env []string) (*exec.Cmd, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	parts := strings.Fields(cmdStr)
 	if len(parts) == 0 {
-		return fmt.Errorf("empty command")
+		return nil, fmt.Errorf("empty command")
 	}
 
 	if err := validateCommand(parts[0]); err != nil {
-		return err
+		return nil, err
 	}
 
 	var cmd *exec.Cmd
@@ -110,8 +352,21 @@ func executeCommand(cmdStr string) error {
 		cmd = exec.Command(parts[0], parts[1:]...)
 	}
 
+	cmd.Dir = dir
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+
+	// Own process group, so the launched process tree can be recognized and
+	// is not interrupted along with flem by a Ctrl-C in the terminal
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
 	log.Debug("Executing command: %s", cmdStr)
-	return cmd.Start()
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	return cmd, nil
 }
 
 // Checks if a command exists in the PATH
@@ -128,62 +383,3 @@ func validateCommand(command string) error {
 
 	return nil
 }
-
-// Resizes a list of applications according to their stored information
-func ResizeApps(appInfos []AppInfo) {
-	log.Info("Resizing %d nodes", len(appInfos))
-
-	for _, app := range appInfos {
-		if app.Size == "" {
-			log.Debug("Skipping resize for mark '%s' (no size specified)", app.Mark)
-			continue
-		}
-
-		mark := NewMark(app.Mark)
-		log.Debug("Resizing mark '%s' to '%s' with layout '%s'", mark.String(), app.Size, app.Layout)
-		if err := ResizeMark(app.Mark, app.Size, app.Layout); err != nil {
-			log.Warn("Failed to resize '%s': %v", app.Mark, err)
-		}
-
-		time.Sleep(200 * time.Millisecond)
-	}
-}
-
-// Resizes a node (app or container) with the given mark
-func ResizeMark(markID string, size string, layout string) error {
-	mark := NewMark(markID)
-	dimension := getDimensionForLayout(layout)
-
-	// Focus the container first
-	if err := mark.Focus(); err != nil {
-		return NewResizeError(markID, size, dimension, layout,
-			fmt.Errorf("%w: failed to focus container before resizing", ErrFocusFailed))
-	}
-
-	time.Sleep(100 * time.Millisecond)
-
-	// Then resize the focused container
-	resizeCmd := mark.ResizeCmd(dimension, size)
-	if _, err := RunCommand(resizeCmd); err != nil {
-		log.Error("Failed to resize container with mark '%s' to %s %s: %v",
-			markID, size, dimension, err)
-		return NewResizeError(markID, size, dimension, layout,
-			fmt.Errorf("%w: command failed", ErrResizeFailed))
-	}
-
-	time.Sleep(100 * time.Millisecond)
-	log.Debug("Successfully resized container with mark '%s' to %s %s", markID, size, dimension)
-
-	return nil
-}
-
-// Determines the resize dimension based on layout type
-func getDimensionForLayout(layout string) string {
-	layoutType, err := types.ParseLayoutType(layout)
-	if err != nil {
-		log.Warn("Unknown layout for resizing: %s, defaulting to width", layout)
-		return "width"
-	}
-
-	return layoutType.ResizeDimension()
-}
@@ -0,0 +1,47 @@
+package sway
+
+import (
+	"os"
+	"testing"
+
+	"github.com/titembaatar/sway.flem/internal/config"
+)
+
+func TestAcceptsWindow(t *testing.T) {
+	pid := os.Getpid()
+	own := &Node{ID: 1, PID: pid, AppID: "foot"}
+	other := &Node{ID: 2, PID: 1, AppID: "foot"}
+	footclient := config.Container{App: "footclient", Match: config.Match{AppID: "^foot$"}}
+
+	tests := []struct {
+		name   string
+		window *Node
+		app    config.Container
+		want   bool
+	}{
+		{"own window without criteria", own, config.Container{App: "foot"}, true},
+		{"other window without criteria", other, config.Container{App: "foot"}, false},
+		{"own window matching criteria", own, footclient, true},
+		{"other window matching criteria", other, footclient, true},
+		{"other window not matching criteria", other, config.Container{App: "firefox", Match: config.Match{AppID: "^firefox$"}}, false},
+		{"own window not matching criteria", own, config.Container{App: "foot", Match: config.Match{Title: "^htop$"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := acceptsWindow(tt.window, tt.app, pid); got != tt.want {
+				t.Errorf("acceptsWindow() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClaimWindow(t *testing.T) {
+	const id = -1
+	if !claimWindow(id) {
+		t.Fatalf("claimWindow() = false for a new window")
+	}
+	if claimWindow(id) {
+		t.Errorf("claimWindow() = true for a window already taken")
+	}
+}
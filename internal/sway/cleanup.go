@@ -0,0 +1,180 @@
+package sway
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/titembaatar/sway.flem/internal/config"
+	"github.com/titembaatar/sway.flem/internal/log"
+)
+
+// Marks set by versions of flem before marks were namespaced
+var legacyMarkRegex = regexp.MustCompile(`^(ws_.+_(app|con)_[0-9]+|scratchpad_[A-Za-z0-9_-]+)$`)
+
+// Mark set by flem, as found in the sway tree
+type MarkStatus struct {
+	Mark      string
+	ConID     int64
+	Name      string // Title of the container
+	Workspace string // Workspace holding the container
+	Stale     string // Why the mark no longer matches the configuration, empty otherwise
+}
+
+// Lists the marks set by flem and checks them against the configuration
+//
+// A mark is stale when its container holds no window anymore, when the
+// configuration has no container for it, or when a mark given by position
+// sits on another workspace than the one it was set up on.
+func CheckMarks(ctx context.Context, cfg *config.Config) ([]MarkStatus, error) {
+	tree, err := GetTree(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var marks []MarkStatus
+	tree.Find(func(n *Node) bool {
+		for _, mark := range n.Marks {
+			if !strings.HasPrefix(mark, MarkPrefix+":") && !legacyMarkRegex.MatchString(mark) {
+				continue
+			}
+
+			status := MarkStatus{Mark: mark, ConID: n.ID, Name: n.Name}
+			workspace := tree.FindWorkspace(n.ID)
+			if workspace != nil {
+				status.Workspace = workspace.Name
+			}
+			status.Stale = staleReason(cfg, n, workspace, status)
+			marks = append(marks, status)
+		}
+		return false
+	})
+
+	log.Debug("Found %d marks set by flem", len(marks))
+	return marks, nil
+}
+
+// Removes marks, returning an error listing those that could not be removed
+func RemoveMarks(ctx context.Context, marks []MarkStatus) error {
+	var errors []string
+
+	for _, mark := range marks {
+		log.Debug("Removing mark '%s' from container %d", mark.Mark, mark.ConID)
+		if _, err := RunCommand(ctx, NewCommand("unmark").Arg(mark.Mark).ForConID(mark.ConID).String()); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Warn("Failed to remove mark '%s': %v", mark.Mark, err)
+			errors = append(errors, fmt.Sprintf("%s: %v", mark.Mark, err))
+		}
+	}
+
+	if len(errors) > 0 {
+		return fmt.Errorf("failed to remove some marks: %s", strings.Join(errors, "; "))
+	}
+	return nil
+}
+
+// Returns why a mark on a node, in the given workspace, is stale, or an empty
+// string
+func staleReason(cfg *config.Config, n *Node, workspaceNode *Node, status MarkStatus) string {
+	if !n.IsWindow() && n.Find((*Node).IsWindow) == nil {
+		return "holds no window"
+	}
+
+	if legacyMarkRegex.MatchString(status.Mark) {
+		return "set by an earlier version of flem"
+	}
+
+	mark, err := ParseMark(status.Mark)
+	if err != nil {
+		return "not a mark of this version of flem"
+	}
+
+	switch mark.Kind {
+	case MarkID:
+		if !hasContainerID(cfg, mark.Name) {
+			return fmt.Sprintf("no container with id '%s'", mark.Name)
+		}
+	case MarkScratchpad:
+		if _, found := cfg.Scratchpad[mark.Name]; !found {
+			return fmt.Sprintf("no scratchpad entry '%s'", mark.Name)
+		}
+	default:
+		workspace, found := workspaceBySwayName(cfg, mark.Workspace)
+		if !found {
+			return fmt.Sprintf("no workspace '%s'", mark.Workspace)
+		}
+		if !workspaceHasMark(workspace, mark) {
+			return fmt.Sprintf("no container at this position of workspace '%s'", mark.Workspace)
+		}
+		if workspaceNode == nil || !isWorkspace(workspaceNode, mark.Workspace, workspace.Number) {
+			return fmt.Sprintf("moved to workspace '%s'", status.Workspace)
+		}
+	}
+
+	return ""
+}
+
+// Returns the workspace of the configuration with the given name in sway,
+// which marks hold instead of its key
+func workspaceBySwayName(cfg *config.Config, name string) (config.Workspace, bool) {
+	for key, workspace := range cfg.Workspaces {
+		if workspace.SwayName(key) == name {
+			return workspace, true
+		}
+	}
+	return config.Workspace{}, false
+}
+
+// Whether a container of the configuration has the given id
+func hasContainerID(cfg *config.Config, id string) bool {
+	var search func(containers []config.Container) bool
+	search = func(containers []config.Container) bool {
+		return slices.ContainsFunc(containers, func(container config.Container) bool {
+			return container.ID == id || search(container.Containers)
+		})
+	}
+
+	for _, workspace := range cfg.Workspaces {
+		if search(workspace.Containers) {
+			return true
+		}
+		for _, variant := range workspace.Variants {
+			if search(variant.Containers) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Whether the workspace, or one of its variants, has a container without an
+// id at the position of an app or container mark
+func workspaceHasMark(workspace config.Workspace, mark Mark) bool {
+	layouts := [][]config.Container{workspace.Containers}
+	for _, variant := range workspace.Variants {
+		layouts = append(layouts, variant.Containers)
+	}
+
+	return slices.ContainsFunc(layouts, func(containers []config.Container) bool {
+		for i, position := range mark.Path {
+			if position >= len(containers) || len(containers[position].Containers) == 0 {
+				return false
+			}
+			if mark.Kind == MarkContainer && i == len(mark.Path)-1 {
+				// Last step: the nested container itself
+				return containers[position].ID == ""
+			}
+			containers = containers[position].Containers
+		}
+
+		if mark.Kind != MarkApp || mark.Index >= len(containers) {
+			return false
+		}
+		container := containers[mark.Index]
+		return container.App != "" && container.ID == ""
+	})
+}
@@ -2,6 +2,7 @@ package sway
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"os/exec"
@@ -35,17 +36,17 @@ func DefaultCommandOptions() SwayCommandOptions {
 }
 
 // Executes a swaymsg command and returns the result
-func RunCommand(command string) ([]CommandResponse, error) {
+func RunCommand(ctx context.Context, command string) ([]CommandResponse, error) {
 	log.SetComponent(log.ComponentSway)
 
 	log.Debug("Executing sway command: %s", command)
 
 	opts := DefaultCommandOptions()
-	return executeSwaymsg(command, opts)
+	return executeSwaymsg(ctx, command, opts)
 }
 
 // Helper for executing swaymsg commands
-func executeSwaymsg(command string, opts SwayCommandOptions) ([]CommandResponse, error) {
+func executeSwaymsg(ctx context.Context, command string, opts SwayCommandOptions) ([]CommandResponse, error) {
 	cmdOp := log.Operation(fmt.Sprintf("sway command '%s'", command))
 	cmdOp.Begin()
 
@@ -59,13 +60,17 @@ func executeSwaymsg(command string, opts SwayCommandOptions) ([]CommandResponse,
 	args = append(args, "--", command)
 
 	log.Debug("Full swaymsg command: swaymsg %s", strings.Join(args, " "))
-	cmd := exec.Command("swaymsg", args...)
+	cmd := exec.CommandContext(ctx, "swaymsg", args...)
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
 	err := cmd.Run()
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		cmdOp.EndWithError(ctxErr)
+		return nil, NewSwayCommandError(command, ctxErr, "")
+	}
 	if err != nil {
 		errMsg := stderr.String()
 		log.Error("Failed to execute sway command '%s': %v", command, err)
@@ -108,20 +113,23 @@ func executeSwaymsg(command string, opts SwayCommandOptions) ([]CommandResponse,
 }
 
 // Helper for sway commands that return JSON data
-func executeSwayGetJSON(command string, outputType string, v any) error {
+func executeSwayGetJSON(ctx context.Context, command string, outputType string, v any) error {
 	// Always use raw output for JSON commands
 	args := []string{"-t", outputType, "-r"}
 	if command != "" {
 		args = append(args, "--", command)
 	}
 
-	cmd := exec.Command("swaymsg", args...)
+	cmd := exec.CommandContext(ctx, "swaymsg", args...)
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
 	err := cmd.Run()
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
 	if err != nil {
 		errMsg := stderr.String()
 		log.Error("Failed to execute sway %s command: %v", outputType, err)
@@ -141,7 +149,7 @@ func executeSwayGetJSON(command string, outputType string, v any) error {
 }
 
 // Retrieves the list of workspaces from sway
-func GetWorkspaces() ([]string, error) {
+func GetWorkspaces(ctx context.Context) ([]string, error) {
 	log.Debug("Getting workspaces from sway")
 
 	type workspace struct {
@@ -149,7 +157,7 @@ func GetWorkspaces() ([]string, error) {
 	}
 
 	var workspaces []workspace
-	if err := executeSwayGetJSON("", "get_workspaces", &workspaces); err != nil {
+	if err := executeSwayGetJSON(ctx, "", "get_workspaces", &workspaces); err != nil {
 		return nil, err
 	}
 
@@ -162,22 +170,21 @@ func GetWorkspaces() ([]string, error) {
 	return names, nil
 }
 
-// Switches to the specified workspace
-func SwitchToWorkspace(workspace string) error {
-	command := fmt.Sprintf("workspace %s", workspace)
-	_, err := RunCommand(command)
+// Switches to the specified workspace, by number when it has one
+func SwitchToWorkspace(ctx context.Context, workspace string, number int) error {
+	_, err := RunCommand(ctx, NewCommand("workspace").Workspace(workspace, number).String())
 	return err
 }
 
-// Creates a new workspace with the specified name and layout
-func CreateWorkspace(name string, layout string) error {
-	if err := SwitchToWorkspace(name); err != nil {
+// Creates a new workspace with the specified name and layout, or reuses the
+// workspace with its number
+func CreateWorkspace(ctx context.Context, name string, number int, layout string) error {
+	if err := SwitchToWorkspace(ctx, name, number); err != nil {
 		return fmt.Errorf("%w: failed to switch to workspace '%s': %v",
 			ErrWorkspaceCreateFailed, name, err)
 	}
 
-	command := fmt.Sprintf("layout %s", layout)
-	_, err := RunCommand(command)
+	_, err := RunCommand(ctx, NewCommand("layout", layout).String())
 	if err != nil {
 		return fmt.Errorf("%w: failed to set layout '%s' for workspace '%s': %v",
 			ErrWorkspaceCreateFailed, layout, name, err)
@@ -188,31 +195,85 @@ func CreateWorkspace(name string, layout string) error {
 }
 
 // Focuses a container with the specified mark
-func FocusByMark(mark string) error {
-	command := fmt.Sprintf("[con_mark=\"%s\"] focus", mark)
-	_, err := RunCommand(command)
+func FocusByMark(ctx context.Context, mark string) error {
+	_, err := RunCommand(ctx, NewCommand("focus").ForMark(mark).String())
 	return err
 }
 
-// Switches focus to each of the specified workspaces in order.
-func FocusWorkspaces(workspaces []string) error {
-	log.Info("Focusing on %d workspaces", len(workspaces))
+// Workspace to switch to, or container to focus by id
+type FocusTarget struct {
+	Workspace string
+	Number    int // Number of the workspace, if numbered
+	ID        string
+}
+
+func (t FocusTarget) String() string {
+	if t.ID != "" {
+		return fmt.Sprintf("container %s", t.ID)
+	}
+	return fmt.Sprintf("workspace %s", t.Workspace)
+}
+
+// Focuses each of the targets in order, the last one keeping the focus
+func Focus(ctx context.Context, targets []FocusTarget) error {
+	log.Info("Focusing on %d targets", len(targets))
 	var errors []string
 
-	for i, workspace := range workspaces {
-		log.Debug("Focusing on workspace: %s", workspace)
-		if err := SwitchToWorkspace(workspace); err != nil {
-			log.Error("Failed to focus on workspace %s: %v", workspace, err)
-			errors = append(errors, fmt.Sprintf("workspace %s: %v", workspace, err))
+	for i, target := range targets {
+		log.Debug("Focusing on %s", target)
+
+		var err error
+		if target.ID != "" {
+			err = NewIDMark(target.ID).Focus(ctx)
+		} else {
+			err = SwitchToWorkspace(ctx, target.Workspace, target.Number)
+		}
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Error("Failed to focus on %s: %v", target, err)
+			errors = append(errors, fmt.Sprintf("%s: %v", target, err))
 		} else {
-			log.Info("Successfully focused on workspace %s (%d of %d)", workspace, i+1, len(workspaces))
-			time.Sleep(100 * time.Millisecond)
+			log.Info("Successfully focused on %s (%d of %d)", target, i+1, len(targets))
+			if err := sleep(ctx, 100*time.Millisecond); err != nil {
+				return err
+			}
 		}
 	}
 
 	if len(errors) > 0 {
-		return fmt.Errorf("failed to focus on some workspaces: %s", strings.Join(errors, "; "))
+		return fmt.Errorf("failed to focus on some targets: %s", strings.Join(errors, "; "))
 	}
 
 	return nil
 }
+
+// Focuses the container with the given id, launched by a setup
+func FocusContainer(ctx context.Context, id string) error {
+	mark := NewIDMark(id)
+
+	tree, err := GetTree(ctx)
+	if err != nil {
+		return err
+	}
+	if tree.FindMark(mark.String()) == nil {
+		return fmt.Errorf("%w: '%s'", ErrContainerNotFound, id)
+	}
+
+	return mark.Focus(ctx)
+}
+
+// Waits for the given duration, returning early if the context is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
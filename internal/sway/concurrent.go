@@ -0,0 +1,73 @@
+package sway
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/titembaatar/sway.flem/internal/config"
+	"github.com/titembaatar/sway.flem/internal/log"
+)
+
+// Sets up the workspaces concurrently, at most opts.Jobs at a time
+//
+// Workspaces are started in setup order, so a workspace never holds a slot
+// while waiting on one that has not started yet, and each one writes to its own
+// entry of the report, which stays ordered whatever the completion order.
+func setupConcurrently(ctx context.Context, cfg *config.Config, report *SetupReport, opts SetupOptions) error {
+	log.Info("Setting up %d workspaces with up to %d jobs", len(report.Workspaces), opts.Jobs)
+
+	jobCtx, abort := context.WithCancelCause(ctx)
+	defer abort(nil)
+
+	slots := make(chan struct{}, opts.Jobs)
+	var wg sync.WaitGroup
+
+	for i, name := range WorkspaceOrder(cfg) {
+		wsReport := report.Workspaces[i]
+		select {
+		case slots <- struct{}{}:
+		case <-jobCtx.Done():
+		}
+		if jobCtx.Err() != nil {
+			log.Warn("Setup stopped before workspace %s: %v", name, context.Cause(jobCtx))
+			break
+		}
+
+		wsReport.Status = WorkspaceRunning
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			log.Info("Processing workspace: %s", name)
+
+			err := setupWorkspaceWithHooks(jobCtx, cfg, name, wsReport, opts)
+
+			if err != nil && jobCtx.Err() == nil {
+				log.Error("Failed to set up workspace %s: %v", name, err)
+				if opts.OnFailure == FailureAbort {
+					abort(fmt.Errorf("aborted at workspace %s: %w", name, err))
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		log.Warn("Setup interrupted: %v", err)
+		report.Finish(err)
+		return err
+	}
+
+	if cause := context.Cause(jobCtx); cause != nil {
+		report.Finish(cause)
+		return cause
+	}
+
+	log.Info("Environment setup complete")
+	report.Finish(nil)
+	return nil
+}
@@ -14,6 +14,18 @@ var (
 	ErrSetLayoutFailed       = errors.New("failed to set container layout")
 	ErrInvalidLayout         = errors.New("invalid layout type")
 	ErrWorkspaceCreateFailed = errors.New("failed to create workspace")
+	ErrInvalidFailurePolicy  = errors.New("invalid failure policy")
+	ErrRollbackFailed        = errors.New("failed to roll back workspace")
+	ErrInvalidLaunchMode     = errors.New("invalid launch mode")
+	ErrWindowTimeout         = errors.New("timed out waiting for window")
+	ErrHookTimeout           = errors.New("hook timed out")
+	ErrProbeTimeout          = errors.New("readiness probe timed out")
+	ErrDependencyFailed      = errors.New("dependency failed")
+	ErrUnknownDependency     = errors.New("no container with this id is set up")
+	ErrScratchpadNotFound    = errors.New("no scratchpad application with this name is running")
+	ErrContainerNotFound     = errors.New("no container with this id was set up")
+	ErrInvalidMark           = errors.New("not a mark set by flem")
+	ErrMarkCollision         = errors.New("mark already set on another container")
 )
 
 type SwayCommandError struct {
@@ -109,3 +121,45 @@ func NewResizeError(mark, size, dimension, layout string, err error) *ResizeErro
 		Err:       err,
 	}
 }
+
+type HookError struct {
+	Stage   string
+	Command string
+	Err     error
+}
+
+func (e *HookError) Error() string {
+	return fmt.Sprintf("%s hook '%s' failed: %v", e.Stage, e.Command, e.Err)
+}
+
+func (e *HookError) Unwrap() error {
+	return e.Err
+}
+
+func NewHookError(stage HookStage, command string, err error) *HookError {
+	return &HookError{
+		Stage:   string(stage),
+		Command: command,
+		Err:     err,
+	}
+}
+
+type DependencyError struct {
+	ID  string
+	Err error
+}
+
+func (e *DependencyError) Error() string {
+	return fmt.Sprintf("dependency '%s' is not ready: %v", e.ID, e.Err)
+}
+
+func (e *DependencyError) Unwrap() error {
+	return e.Err
+}
+
+func NewDependencyError(id string, err error) *DependencyError {
+	return &DependencyError{
+		ID:  id,
+		Err: err,
+	}
+}
@@ -0,0 +1,120 @@
+package sway
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/titembaatar/sway.flem/internal/config"
+	"github.com/titembaatar/sway.flem/internal/log"
+	"github.com/titembaatar/sway.flem/pkg/types"
+)
+
+// Makes the window with the given mark float at the geometry of its container
+//
+// Sizes in ppt are relative to the output. Anchored positions are computed
+// from the window size once resized, as sway only moves windows to
+// coordinates or to the center.
+func applyFloating(ctx context.Context, mark Mark, app config.Container) error {
+	commands := []string{"floating enable"}
+	if resize := floatingResizeCommand(app); resize != "" {
+		commands = append(commands, resize)
+	}
+
+	// Validated along with the configuration
+	position, _ := types.ParsePosition(app.Position)
+	switch position.Kind {
+	case types.PositionCenter:
+		commands = append(commands, "move position center")
+	case types.PositionAbsolute:
+		commands = append(commands, fmt.Sprintf("move position %s %s", sizeCommand(position.X), sizeCommand(position.Y)))
+	}
+
+	for _, command := range commands {
+		if _, err := RunCommand(ctx, mark.Command(command).String()); err != nil {
+			return fmt.Errorf("failed to make '%s' float: %w", mark, err)
+		}
+	}
+
+	if position.Kind == types.PositionAnchor {
+		return moveToAnchor(ctx, mark, position)
+	}
+
+	log.Debug("Window '%s' is floating", mark)
+	return nil
+}
+
+// Returns the command setting the floating size of the container, if any
+func floatingResizeCommand(app config.Container) string {
+	var parts []string
+
+	if width, _ := types.ParseSize(app.Width); !width.IsEmpty() {
+		parts = append(parts, "width", sizeCommand(width))
+	}
+	if height, _ := types.ParseSize(app.Height); !height.IsEmpty() {
+		parts = append(parts, "height", sizeCommand(height))
+	}
+
+	if len(parts) == 0 {
+		return ""
+	}
+	return "resize set " + strings.Join(parts, " ")
+}
+
+// Sway amount for a size, e.g. "50 ppt" or "0 px"
+func sizeCommand(size types.Size) string {
+	if size.IsEmpty() {
+		return "0 px"
+	}
+	return fmt.Sprintf("%d %s", size.Value, size.Unit)
+}
+
+// Moves the window with the given mark against the edges of its workspace
+func moveToAnchor(ctx context.Context, mark Mark, position types.Position) error {
+	tree, err := GetTree(ctx)
+	if err != nil {
+		return err
+	}
+
+	window := tree.FindMark(mark.String())
+	if window == nil {
+		return fmt.Errorf("no window with mark '%s'", mark)
+	}
+	workspace := tree.FindWorkspace(window.ID)
+	if workspace == nil {
+		return fmt.Errorf("no workspace holds '%s'", mark)
+	}
+
+	area := workspace.Rect
+	marginX, marginY := position.Margin.Value, position.Margin.Value
+	if position.Margin.Unit == types.UnitPercent {
+		marginX = area.Width * position.Margin.Value / 100
+		marginY = area.Height * position.Margin.Value / 100
+	}
+
+	top, bottom, left, right := position.Anchor.Edges()
+	x := anchorOffset(left, right, area.Width, window.Rect.Width, marginX)
+	y := anchorOffset(top, bottom, area.Height, window.Rect.Height, marginY)
+
+	command := mark.Command("move", "position", strconv.Itoa(x), "px", strconv.Itoa(y), "px")
+	if _, err := RunCommand(ctx, command.String()); err != nil {
+		return fmt.Errorf("failed to move '%s' to %s: %w", mark, position, err)
+	}
+
+	log.Debug("Window '%s' is floating at %s", mark, position)
+	return nil
+}
+
+// Offset of a window along one axis of the workspace, against the start or
+// end edge, or centered when against neither
+func anchorOffset(start, end bool, area, size, margin int) int {
+	switch {
+	case start:
+		return margin
+	case end:
+		return area - size - margin
+	default:
+		return (area - size) / 2
+	}
+}
@@ -0,0 +1,179 @@
+package sway
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/titembaatar/sway.flem/internal/config"
+	"github.com/titembaatar/sway.flem/internal/log"
+)
+
+// Point of the setup at which hooks run
+type HookStage string
+
+const (
+	HookBeforeAll       HookStage = "before_all"
+	HookAfterAll        HookStage = "after_all"
+	HookBeforeWorkspace HookStage = "before_workspace"
+	HookAfterWorkspace  HookStage = "after_workspace"
+	HookOnFailure       HookStage = "on_failure"
+)
+
+// Time a hook may run when no timeout is configured
+const defaultHookTimeout = 30 * time.Second
+
+// Time to wait for the output of a hook once it was killed
+const hookWaitDelay = time.Second
+
+// Outcome of a hook
+type HookResult struct {
+	Stage    HookStage     `json:"stage"`
+	Command  string        `json:"command"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Whether hooks of the stage gate what follows them
+func (s HookStage) isBefore() bool {
+	return s == HookBeforeAll || s == HookBeforeWorkspace
+}
+
+// Runs the hooks of a stage in order with the given extra environment
+//
+// Hooks run before a step stop at the first failure, as the step will not run;
+// the others all run and their failures are combined.
+func RunHooks(ctx context.Context, stage HookStage, hooks []config.Hook, env []string) ([]HookResult, error) {
+	if len(hooks) == 0 {
+		return nil, nil
+	}
+
+	log.Info("Running %d %s hooks", len(hooks), stage)
+
+	var results []HookResult
+	var failures []error
+
+	for _, hook := range hooks {
+		start := time.Now()
+		err := runHook(ctx, stage, hook, env)
+
+		result := HookResult{Stage: stage, Command: hook.Cmd, Duration: time.Since(start)}
+		if err != nil {
+			result.Error = err.Error()
+			failures = append(failures, NewHookError(stage, hook.Cmd, err))
+		}
+		results = append(results, result)
+
+		if err != nil && (stage.isBefore() || ctx.Err() != nil) {
+			break
+		}
+	}
+
+	return results, errors.Join(failures...)
+}
+
+// Runs a single hook through the shell and waits for it
+func runHook(ctx context.Context, stage HookStage, hook config.Hook, env []string) error {
+	timeout := defaultHookTimeout
+	if hook.Timeout != 0 {
+		timeout = time.Duration(hook.Timeout) * time.Second
+	}
+
+	hookCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	log.Debug("Running %s hook: %s", stage, hook.Cmd)
+
+	cmd := exec.CommandContext(hookCtx, "sh", "-c", hook.Cmd)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Env = append(cmd.Env, "FLEM_HOOK="+string(stage))
+	cmd.WaitDelay = hookWaitDelay
+
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	err := cmd.Run()
+	if err == nil {
+		return nil
+	}
+
+	if out := strings.TrimSpace(output.String()); out != "" {
+		log.Error("Output of %s hook '%s': %s", stage, hook.Cmd, out)
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if hookCtx.Err() != nil {
+		return fmt.Errorf("%w after %s", ErrHookTimeout, timeout)
+	}
+	return err
+}
+
+// Environment passed to the hooks of a workspace
+//
+// The report is only written once the whole setup is done, so it is not
+// passed to workspace hooks.
+func workspaceHookEnv(name string, status WorkspaceStatus) []string {
+	env := []string{"FLEM_WORKSPACE=" + name}
+	if status != "" {
+		env = append(env, "FLEM_STATUS="+string(status))
+	}
+	return env
+}
+
+// Sets up a workspace surrounded by its hooks
+//
+// Top-level before_workspace hooks run before the workspace ones and
+// after_workspace hooks in the reverse order. A failing before_workspace hook
+// fails the workspace, which then runs its own on_failure hooks; top-level
+// on_failure hooks run once, at the end of the setup.
+func setupWorkspaceWithHooks(
+	ctx context.Context,
+	cfg *config.Config,
+	name string,
+	report *WorkspaceReport,
+	opts SetupOptions,
+) error {
+	workspace := cfg.Workspaces[name]
+	swayName := workspace.SwayName(name)
+	report.Status = WorkspaceRunning
+	start := time.Now()
+
+	before := slices.Concat(cfg.Hooks.BeforeWorkspace, workspace.Hooks.BeforeWorkspace)
+	results, err := RunHooks(ctx, HookBeforeWorkspace, before, workspaceHookEnv(swayName, ""))
+	report.Hooks = append(report.Hooks, results...)
+
+	if err == nil {
+		err = SetupWorkspace(ctx, name, workspace, report, opts)
+	}
+	report.finish(start, err)
+	opts.readiness.abandon(name, err)
+
+	env := workspaceHookEnv(swayName, report.Status)
+	if err == nil {
+		after := slices.Concat(workspace.Hooks.AfterWorkspace, cfg.Hooks.AfterWorkspace)
+		results, hookErr := RunHooks(ctx, HookAfterWorkspace, after, env)
+		report.Hooks = append(report.Hooks, results...)
+		if hookErr != nil {
+			log.Warn("Some after_workspace hooks failed for %s: %v", name, hookErr)
+		}
+		return nil
+	}
+
+	// Failure hooks also run when the setup was interrupted
+	results, hookErr := RunHooks(context.WithoutCancel(ctx), HookOnFailure, workspace.Hooks.OnFailure, env)
+	report.Hooks = append(report.Hooks, results...)
+	if hookErr != nil {
+		log.Warn("Some on_failure hooks failed for %s: %v", name, hookErr)
+	}
+
+	return err
+}
@@ -1,258 +1,423 @@
 package sway
 
 import (
+	"context"
 	"fmt"
+	"maps"
+	"slices"
 
 	"github.com/titembaatar/sway.flem/internal/config"
 	"github.com/titembaatar/sway.flem/internal/log"
 	"github.com/titembaatar/sway.flem/pkg/types"
 )
 
+// State shared while building a single workspace
+type workspaceBuilder struct {
+	name     string // Name of the workspace in sway
+	number   int    // Number of the workspace, if numbered
+	policy   FailurePolicy
+	detached bool // Whether the build must not rely on focus
+	launch   LaunchOptions
+	report   *WorkspaceReport
+	tx       *Transaction
+	ready    *readinessTracker
+}
+
+// Returns the workspaces of the configuration in setup order
+//
+// Workspaces come after the workspaces their containers depend on, and in name
+// order otherwise.
+func WorkspaceOrder(cfg *config.Config) []string {
+	names := slices.Sorted(maps.Keys(cfg.Workspaces))
+	deps := cfg.WorkspaceDependencies()
+
+	order := make([]string, 0, len(names))
+	added := make(map[string]bool)
+
+	for len(order) < len(names) {
+		progress := false
+		for _, name := range names {
+			if added[name] {
+				continue
+			}
+			if slices.ContainsFunc(deps[name], func(dep string) bool { return !added[dep] }) {
+				continue
+			}
+			order = append(order, name)
+			added[name] = true
+			progress = true
+			break
+		}
+
+		// Cycles are rejected by the validator, keep name order if one remains
+		if !progress {
+			for _, name := range names {
+				if !added[name] {
+					order = append(order, name)
+					added[name] = true
+				}
+			}
+		}
+	}
+
+	return order
+}
+
 // Sets up the entire environment from the configuration
-func SetupEnvironment(cfg *config.Config) error {
-	log.Info("Setting up environment from configuration")
+//
+// The report must list the workspaces in WorkspaceOrder; it is filled in as
+// the setup goes and describes what was done so far, even when the context is
+// cancelled halfway through.
+func SetupEnvironment(ctx context.Context, cfg *config.Config, report *SetupReport, opts SetupOptions) error {
+	log.Info("Setting up environment from configuration (launch: %s, on failure: %s)", opts.Launch, opts.OnFailure)
+
+	opts.readiness = newReadinessTracker(cfg)
+
+	if err := setupScratchpad(ctx, cfg, report, opts); err != nil {
+		report.Finish(err)
+		return err
+	}
+
+	if opts.Jobs > 1 {
+		return setupConcurrently(ctx, cfg, report, opts)
+	}
+
+	for i, name := range WorkspaceOrder(cfg) {
+		wsReport := report.Workspaces[i]
+		if err := ctx.Err(); err != nil {
+			log.Warn("Setup interrupted before workspace %s: %v", name, err)
+			report.Finish(err)
+			return err
+		}
 
-	for name, workspace := range cfg.Workspaces {
 		log.Info("Processing workspace: %s", name)
 
-		if err := SetupWorkspace(name, workspace); err != nil {
+		err := setupWorkspaceWithHooks(ctx, cfg, name, wsReport, opts)
+		if err != nil {
+			if ctx.Err() != nil {
+				log.Warn("Setup interrupted during workspace %s: %v", name, err)
+				report.Finish(ctx.Err())
+				return ctx.Err()
+			}
 			log.Error("Failed to set up workspace %s: %v", name, err)
+
+			if opts.OnFailure == FailureAbort {
+				abortErr := fmt.Errorf("aborted at workspace %s: %w", name, err)
+				report.Finish(abortErr)
+				return abortErr
+			}
 			// Continue with other workspaces even if one fails
 			continue
 		}
 	}
 
 	log.Info("Environment setup complete")
+	report.Finish(nil)
 	return nil
 }
 
-// Sets up a workspace with the specified layout
-func SetupWorkspace(workspaceName string, workspace config.Workspace) error {
-	log.Info("Setting up workspace: %s", workspaceName)
+// Sets up a workspace with the specified layout, given its key in the
+// configuration
+//
+// With the rollback policy, a failing workspace has its launched windows
+// closed and its marks removed before the error is returned.
+func SetupWorkspace(
+	ctx context.Context,
+	workspaceName string,
+	workspace config.Workspace,
+	report *WorkspaceReport,
+	opts SetupOptions,
+) error {
+	name := workspace.SwayName(workspaceName)
+	log.Info("Setting up workspace: %s", name)
+
+	b := &workspaceBuilder{
+		name:     name,
+		number:   workspace.Number,
+		policy:   opts.OnFailure,
+		detached: opts.Jobs > 1,
+		launch: LaunchOptions{
+			WaitDelay:      true,
+			AllowFocusMark: opts.AllowFocusMark,
+			ReplaceMarks:   opts.ReplaceMarks,
+			Workspace:      name,
+		},
+		report: report,
+		tx:     NewTransaction(name),
+		ready:  opts.readiness,
+	}
 
-	if err := CreateWorkspace(workspaceName, workspace.Layout.String()); err != nil {
-		return fmt.Errorf("failed to create workspace: %w", err)
+	if len(workspace.Output) > 0 {
+		output, err := assignOutput(ctx, name, workspace.Number, workspace.Output)
+		if err != nil {
+			if err := b.handleError(ctx, "Failed to assign workspace to output", err); err != nil {
+				return err
+			}
+		}
+		report.Output = output
+	}
+
+	var err error
+	if opts.Launch == LaunchParallel || b.detached {
+		err = b.buildParallel(ctx, workspace)
+	} else {
+		err = b.build(ctx, workspace)
+	}
+	if err != nil && b.policy == FailureRollback {
+		if rbErr := b.tx.Rollback(ctx); rbErr != nil {
+			log.Error("Failed to roll back workspace %s: %v", name, rbErr)
+			report.AddError(rbErr)
+		} else {
+			report.RolledBack = true
+		}
 	}
 
-	var resizeInfo []AppInfo
+	return err
+}
+
+// Builds the workspace layout one application at a time and resizes its
+// containers
+func (b *workspaceBuilder) build(ctx context.Context, workspace config.Workspace) error {
+	if err := CreateWorkspace(ctx, b.name, b.number, workspace.Layout.String()); err != nil {
+		return fmt.Errorf("failed to create workspace: %w", err)
+	}
 
 	if len(workspace.Containers) > 0 {
-		containerInfo, err := processContainers(workspaceName, workspace.Layout.String(), workspace.Containers, 0)
-		if err != nil {
-			log.Error("Failed to process workspace containers: %v", err)
-		} else {
-			resizeInfo = append(resizeInfo, containerInfo...)
+		if err := b.processContainers(ctx, workspace.Containers, nil, 0); err != nil {
+			if err := b.handleError(ctx, "Failed to process workspace containers", err); err != nil {
+				return err
+			}
 		}
 	}
 
-	ResizeApps(resizeInfo)
+	if err := ResizeWorkspace(ctx, b.name, workspace.Containers); err != nil {
+		return err
+	}
 
-	log.Info("Workspace %s setup complete", workspaceName)
+	log.Info("Workspace %s setup complete", b.name)
 	return nil
 }
 
-// Processes a list of containers at the same level
-func processContainers(workspaceName, parentLayout string, containers []config.Container, depth int) ([]AppInfo, error) {
-	log.Info("Processing %d containers at depth %d", len(containers), depth)
+// Handles an error according to the failure policy
+//
+// Returns nil when the setup should keep going, otherwise the error to return.
+func (b *workspaceBuilder) handleError(ctx context.Context, msg string, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	log.Error("%s: %v", msg, err)
+	if b.policy != FailureKeep {
+		return err
+	}
+
+	b.report.AddError(err)
+	return nil
+}
 
-	var resizeInfo []AppInfo
+// Launches the application of a container once its dependencies are ready,
+// and tracks its own readiness for its dependents
+func (b *workspaceBuilder) launchContainer(ctx context.Context, app config.Container, mark Mark, opts LaunchOptions) (*Node, error) {
+	if err := b.ready.wait(ctx, app.DependsOn); err != nil {
+		b.ready.failed(app.ID, err)
+		return nil, err
+	}
 
-	containerCounter := depth
+	window, err := LaunchApp(ctx, app, mark, opts)
+	if err != nil {
+		b.ready.failed(app.ID, err)
+		return window, err
+	}
+
+	b.ready.launched(ctx, app.ID, window)
+	return window, nil
+}
+
+// Records a window launched by flem and identified by the given mark
+func (b *workspaceBuilder) recordLaunch(mark string) {
+	b.tx.RecordLaunch(mark)
+	b.report.AddMark(mark)
+}
+
+// Processes a list of containers at the same level
+//
+// The path holds the positions of the nested containers leading to the list,
+// and offset the position of its first container in its parent.
+func (b *workspaceBuilder) processContainers(
+	ctx context.Context,
+	containers []config.Container,
+	path []int,
+	offset int,
+) error {
+	log.Info("Processing %d containers at depth %d", len(containers), len(path))
 
 	for i, container := range containers {
+		index := offset + i
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		isApp := container.App != ""
 
 		if isApp {
-			appInfo, err := processAppContainer(workspaceName, parentLayout, container, depth, containerCounter, i)
-			if err != nil {
-				log.Error("Failed to process app container %s: %v", container.App, err)
-				continue
-			}
-
-			if appInfo.Size != "" {
-				resizeInfo = append(resizeInfo, appInfo)
+			if err := b.processAppContainer(ctx, container, path, index); err != nil {
+				msg := fmt.Sprintf("Failed to process app container %s", container.App)
+				if err := b.handleError(ctx, msg, err); err != nil {
+					return err
+				}
 			}
 		} else {
-			containerResizeInfo, newContainerID, err := processNestedContainer(
-				workspaceName,
-				parentLayout,
+			err := b.processNestedContainer(
+				ctx,
 				container,
-				depth,
-				containerCounter,
+				append(slices.Clone(path), index),
 			)
 
 			if err != nil {
-				log.Error("Failed to process nested container: %v", err)
-				continue
+				if err := b.handleError(ctx, "Failed to process nested container", err); err != nil {
+					return err
+				}
 			}
-
-			containerCounter = newContainerID
-			resizeInfo = append(resizeInfo, containerResizeInfo...)
 		}
 	}
 
-	return resizeInfo, nil
+	return nil
 }
 
 // Handles a single application container
-func processAppContainer(
-	workspaceName string,
-	parentLayout string,
+func (b *workspaceBuilder) processAppContainer(
+	ctx context.Context,
 	container config.Container,
-	depth int,
-	containerID int,
+	path []int,
 	index int,
-) (AppInfo, error) {
-	mark := NewAppMark(workspaceName, depth, containerID, index)
-
-	app := config.Container{
-		App:   container.App,
-		Cmd:   container.Cmd,
-		Size:  container.Size,
-		Delay: container.Delay,
-		Post:  container.Post,
+) error {
+	mark := markForApp(container, b.name, path, index)
+
+	// New windows open next to the focused one, which must stay in the tiled
+	// layout for the following siblings
+	var previous *Node
+	if container.Floating {
+		tree, err := GetTree(ctx)
+		if err != nil {
+			return err
+		}
+		previous = tree.Find(func(n *Node) bool { return n.Focused })
+	}
+
+	if _, err := b.launchContainer(ctx, container, mark, b.launch); err != nil {
+		return fmt.Errorf("failed to launch app %s: %w", container.App, err)
 	}
+	b.recordLaunch(mark.String())
 
-	if err := LaunchApp(app, mark.String()); err != nil {
-		return AppInfo{}, fmt.Errorf("failed to launch app %s: %w", container.App, err)
+	if previous != nil {
+		if _, err := RunCommand(ctx, NewCommand("focus").ForConID(previous.ID).String()); err != nil {
+			log.Warn("Failed to focus back container %d after floating '%s': %v", previous.ID, mark, err)
+		}
 	}
 
-	return AppInfo{
-		Mark:   mark.String(),
-		Size:   container.Size,
-		Layout: parentLayout,
-	}, nil
+	return nil
 }
 
-// Handles a container with child containers
-func processNestedContainer(
-	workspaceName string,
-	parentLayout string,
+// Handles a container with child containers, at the given path
+func (b *workspaceBuilder) processNestedContainer(
+	ctx context.Context,
 	container config.Container,
-	depth int,
-	containerID int,
-) ([]AppInfo, int, error) {
-	var resizeInfo []AppInfo
-
+	path []int,
+) error {
 	if len(container.Containers) == 0 {
-		return nil, containerID, fmt.Errorf("container has no child containers")
+		return fmt.Errorf("container has no child containers")
 	}
 
 	firstChild := container.Containers[0]
-	containerMark := NewContainerMark(workspaceName, containerID)
-	newContainerID := containerID + 1
+	containerMark := markForContainer(container, b.name, path)
 
 	if firstChild.App != "" {
-		firstChildInfo, err := setupContainerWithApp(
-			workspaceName,
-			parentLayout,
+		err := b.setupContainerWithApp(
+			ctx,
 			container,
 			firstChild,
-			depth,
-			containerID,
-			containerMark.String(),
+			path,
+			containerMark,
 		)
 
 		if err != nil {
-			return nil, newContainerID, fmt.Errorf("failed to setup container with app: %w", err)
+			return fmt.Errorf("failed to setup container with app: %w", err)
 		}
 
-		resizeInfo = append(resizeInfo, firstChildInfo...)
-
 		if len(container.Containers) > 1 {
-			if err := containerMark.Focus(); err != nil {
-				return resizeInfo, newContainerID, fmt.Errorf("failed to focus container: %w", err)
+			if err := containerMark.Focus(ctx); err != nil {
+				return fmt.Errorf("failed to focus container: %w", err)
 			}
 
-			childInfo, err := processContainers(
-				workspaceName,
-				container.Split.String(),
+			err := b.processContainers(
+				ctx,
 				container.Containers[1:],
-				depth+1,
+				path,
+				1,
 			)
 
 			if err != nil {
-				log.Error("Failed to process child containers: %v", err)
-			} else {
-				resizeInfo = append(resizeInfo, childInfo...)
+				if err := b.handleError(ctx, "Failed to process child containers", err); err != nil {
+					return err
+				}
 			}
 		}
 	} else {
 		log.Warn("First child of container is not an app but another container - this might cause layout issues")
 
-		childInfo, err := processContainers(
-			workspaceName,
-			container.Split.String(),
+		err := b.processContainers(
+			ctx,
 			container.Containers,
-			depth+1,
+			path,
+			0,
 		)
 
 		if err != nil {
-			log.Error("Failed to process child containers: %v", err)
-		} else {
-			resizeInfo = append(resizeInfo, childInfo...)
+			if err := b.handleError(ctx, "Failed to process child containers", err); err != nil {
+				return err
+			}
 		}
 	}
 
-	return resizeInfo, newContainerID, nil
+	return nil
 }
 
 // Sets up a container by creating its first app and setting the layout
-func setupContainerWithApp(
-	workspaceName string,
-	parentLayout string,
+func (b *workspaceBuilder) setupContainerWithApp(
+	ctx context.Context,
 	container config.Container,
 	firstChild config.Container,
-	depth int,
-	containerID int,
-	containerMark string,
-) ([]AppInfo, error) {
-	var resizeInfo []AppInfo
-
-	firstAppMark := NewAppMark(workspaceName, depth+1, containerID, 0).String()
-
-	app := config.Container{
-		App:   firstChild.App,
-		Cmd:   firstChild.Cmd,
-		Size:  firstChild.Size,
-		Delay: firstChild.Delay,
-		Post:  firstChild.Post,
-	}
-
-	if err := LaunchApp(app, firstAppMark); err != nil {
-		return nil, fmt.Errorf("failed to launch container's first app: %w", err)
-	}
+	path []int,
+	containerMark Mark,
+) error {
+	firstAppMark := markForApp(firstChild, b.name, path, 0)
 
-	containerMarkObj := NewMark(containerMark)
-	if err := containerMarkObj.Apply(); err != nil {
-		log.Warn("Failed to apply container mark: %v", err)
-	}
-
-	if err := setContainerLayout(container.Split.String()); err != nil {
-		log.Warn("Failed to set container layout: %v", err)
+	window, err := b.launchContainer(ctx, firstChild, firstAppMark, b.launch)
+	if err != nil {
+		return fmt.Errorf("failed to launch container's first app: %w", err)
 	}
+	b.recordLaunch(firstAppMark.String())
 
-	if container.Size != "" {
-		resizeInfo = append(resizeInfo, AppInfo{
-			Mark:   containerMark,
-			Size:   container.Size,
-			Layout: parentLayout,
-		})
+	if err := containerMark.ApplyTo(ctx, window.ID, b.launch.ReplaceMarks); err != nil {
+		if err := b.handleError(ctx, "Failed to apply container mark", err); err != nil {
+			return err
+		}
+	} else {
+		b.tx.RecordMark(containerMark.String())
 	}
 
-	if firstChild.Size != "" {
-		resizeInfo = append(resizeInfo, AppInfo{
-			Mark:   firstAppMark,
-			Size:   firstChild.Size,
-			Layout: container.Split.String(),
-		})
+	if err := setContainerLayout(ctx, window.ID, container.Split.String()); err != nil {
+		if err := b.handleError(ctx, "Failed to set container layout", err); err != nil {
+			return err
+		}
 	}
 
-	return resizeInfo, nil
+	return nil
 }
 
-// Applies the specified layout to the current container
-func setContainerLayout(layoutType string) error {
+// Splits the container with the given ID and applies the specified layout
+func setContainerLayout(ctx context.Context, conID int64, layoutType string) error {
 	layout, err := types.ParseLayoutType(layoutType)
 	if err != nil {
 		return fmt.Errorf("%w: '%s' is not a valid layout type", ErrInvalidLayout, layoutType)
@@ -269,7 +434,7 @@ func setContainerLayout(layoutType string) error {
 	}
 
 	for _, command := range commands {
-		if _, err := RunCommand(command); err != nil {
+		if _, err := RunCommand(ctx, NewCommand(command).ForConID(conID).String()); err != nil {
 			return err
 		}
 	}
@@ -2,11 +2,15 @@ package sway
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"os/exec"
+	"slices"
+	"strconv"
 	"strings"
 
+	"github.com/titembaatar/sway.flem/internal/config"
 	"github.com/titembaatar/sway.flem/internal/log"
 )
 
@@ -14,99 +18,299 @@ const (
 	MarkPrefix = "flem"
 )
 
+// Kind of container a mark identifies
+type MarkKind string
+
+// Mark kinds
+const (
+	MarkApp        MarkKind = "app"        // Application, by position in its workspace
+	MarkContainer  MarkKind = "con"        // Nested container, by position in its workspace
+	MarkID         MarkKind = "id"         // Container with a user-defined id
+	MarkScratchpad MarkKind = "scratchpad" // Scratchpad application, by name
+)
+
+// Mark identifying a container set up by flem
+//
+// Marks are encoded as 'flem:app:<workspace>:<path>:<index>',
+// 'flem:con:<workspace>:<path>', 'flem:scratchpad:<name>' or 'flem:<id>', where
+// the path lists the positions of the nested containers from the workspace,
+// separated by '.'. Workspace and scratchpad names are escaped so that any
+// name round-trips and the mark only holds characters safe in sway commands.
 type Mark struct {
-	ID string
+	Kind      MarkKind
+	Workspace string // Workspace of app and container marks
+	Path      []int  // Positions of the nested containers leading to the container
+	Index     int    // Position of an application in its container
+	Name      string // Id or scratchpad name
+}
+
+// Creates a mark for an application, by its position in a workspace
+func NewAppMark(workspaceName string, path []int, appIndex int) Mark {
+	return Mark{Kind: MarkApp, Workspace: workspaceName, Path: slices.Clone(path), Index: appIndex}
+}
+
+// Creates a mark for a nested container, by its position in a workspace
+func NewContainerMark(workspaceName string, path []int) Mark {
+	return Mark{Kind: MarkContainer, Workspace: workspaceName, Path: slices.Clone(path)}
+}
+
+// Creates the mark of a container with an id, stable across configuration
+// changes
+func NewIDMark(id string) Mark {
+	return Mark{Kind: MarkID, Name: id}
 }
 
-func NewMark(id string) Mark {
-	return Mark{ID: id}
+// Mark of an application container: its id mark, or its position
+func markForApp(container config.Container, workspaceName string, path []int, appIndex int) Mark {
+	if container.ID != "" {
+		return NewIDMark(container.ID)
+	}
+	return NewAppMark(workspaceName, path, appIndex)
 }
 
-// Creates a mark for an application in a workspace
-func NewAppMark(workspaceName string, depth, containerID, appIndex int) Mark {
-	var id string
-	if depth == 0 {
-		// Top-level app
-		id = fmt.Sprintf("ws_%s_app_%d", workspaceName, appIndex+1)
-	} else {
-		// App in a container
-		id = fmt.Sprintf("ws_%s_con_%d_app_%d", workspaceName, containerID, appIndex+1)
+// Mark of a nested container: its id mark, or its position
+func markForContainer(container config.Container, workspaceName string, path []int) Mark {
+	if container.ID != "" {
+		return NewIDMark(container.ID)
 	}
-	return Mark{ID: id}
+	return NewContainerMark(workspaceName, path)
 }
 
-// Creates a mark for a container in a workspace
-func NewContainerMark(workspaceName string, containerID int) Mark {
-	return Mark{ID: fmt.Sprintf("ws_%s_con_%d", workspaceName, containerID)}
+// Creates a mark for a scratchpad application
+func NewScratchpadMark(name string) Mark {
+	return Mark{Kind: MarkScratchpad, Name: name}
 }
 
-// String representation of the mark
+// Encoded mark, as applied in sway
 func (m Mark) String() string {
-	return m.ID
+	switch m.Kind {
+	case MarkApp:
+		return strings.Join([]string{MarkPrefix, string(m.Kind), escapeMarkField(m.Workspace), formatMarkPath(m.Path), strconv.Itoa(m.Index)}, ":")
+	case MarkContainer:
+		return strings.Join([]string{MarkPrefix, string(m.Kind), escapeMarkField(m.Workspace), formatMarkPath(m.Path)}, ":")
+	case MarkScratchpad:
+		return strings.Join([]string{MarkPrefix, string(m.Kind), escapeMarkField(m.Name)}, ":")
+	default:
+		return MarkPrefix + ":" + escapeMarkField(m.Name)
+	}
+}
+
+// Parses an encoded mark, failing on marks not set by flem
+func ParseMark(s string) (Mark, error) {
+	rest, found := strings.CutPrefix(s, MarkPrefix+":")
+	if !found {
+		return Mark{}, fmt.Errorf("%w: '%s'", ErrInvalidMark, s)
+	}
+
+	fields := strings.Split(rest, ":")
+	invalid := func() (Mark, error) {
+		return Mark{}, fmt.Errorf("%w: '%s'", ErrInvalidMark, s)
+	}
+
+	if len(fields) == 1 {
+		name, err := unescapeMarkField(fields[0])
+		if err != nil || name == "" {
+			return invalid()
+		}
+		return Mark{Kind: MarkID, Name: name}, nil
+	}
+
+	m := Mark{Kind: MarkKind(fields[0])}
+	var err error
+
+	switch {
+	case m.Kind == MarkScratchpad && len(fields) == 2:
+		m.Name, err = unescapeMarkField(fields[1])
+	case m.Kind == MarkContainer && len(fields) == 3:
+		if m.Workspace, err = unescapeMarkField(fields[1]); err == nil {
+			m.Path, err = parseMarkPath(fields[2])
+		}
+	case m.Kind == MarkApp && len(fields) == 4:
+		if m.Workspace, err = unescapeMarkField(fields[1]); err == nil {
+			m.Path, err = parseMarkPath(fields[2])
+		}
+		if err == nil {
+			m.Index, err = parseMarkNumber(fields[3])
+		}
+	default:
+		return invalid()
+	}
+
+	if err != nil {
+		return invalid()
+	}
+	return m, nil
+}
+
+// Whether two marks identify the same container
+func (m Mark) Equal(other Mark) bool {
+	return m.Kind == other.Kind && m.Workspace == other.Workspace && slices.Equal(m.Path, other.Path) &&
+		m.Index == other.Index && m.Name == other.Name
+}
+
+// Starts a command for the container with this mark
+//
+// Sway matches con_mark as a regular expression, so the mark is quoted and
+// anchored to select this mark only.
+func (m Mark) Command(keywords ...string) *Command {
+	return NewCommand(keywords...).ForMark(m.String())
+}
+
+// Characters kept as they are in mark fields; others are escaped as %XX
+func isMarkChar(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_' || c == '-' || c == '.'
+}
+
+func escapeMarkField(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if isMarkChar(s[i]) {
+			b.WriteByte(s[i])
+		} else {
+			fmt.Fprintf(&b, "%%%02X", s[i])
+		}
+	}
+	return b.String()
+}
+
+func unescapeMarkField(s string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '%' && i+2 < len(s) && isUpperHex(s[i+1]) && isUpperHex(s[i+2]):
+			c, _ := strconv.ParseUint(s[i+1:i+3], 16, 8)
+			if isMarkChar(byte(c)) {
+				return "", ErrInvalidMark // Not produced by escapeMarkField
+			}
+			b.WriteByte(byte(c))
+			i += 2
+		case isMarkChar(s[i]):
+			b.WriteByte(s[i])
+		default:
+			return "", ErrInvalidMark
+		}
+	}
+	return b.String(), nil
+}
+
+func isUpperHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'A' <= c && c <= 'F'
+}
+
+func formatMarkPath(path []int) string {
+	parts := make([]string, len(path))
+	for i, position := range path {
+		parts[i] = strconv.Itoa(position)
+	}
+	return strings.Join(parts, ".")
+}
+
+func parseMarkPath(s string) ([]int, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var path []int
+	for _, part := range strings.Split(s, ".") {
+		position, err := parseMarkNumber(part)
+		if err != nil {
+			return nil, err
+		}
+		path = append(path, position)
+	}
+	return path, nil
+}
+
+// Parses a position, in the canonical form written by strconv.Itoa
+func parseMarkNumber(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || strconv.Itoa(n) != s {
+		return 0, ErrInvalidMark
+	}
+	return n, nil
 }
 
 // Focus a container with this mark
 func (m Mark) FocusCmd() string {
-	return fmt.Sprintf("[con_mark=\"%s\"] focus", m.ID)
+	return m.Command("focus").String()
 }
 
-// Resize a container with this mark
-func (m Mark) ResizeCmd(dimension string, size string) string {
-	return fmt.Sprintf("resize set %s %s", dimension, size)
+// Applies the mark to the currently focused container
+func (m Mark) Apply(ctx context.Context) error {
+	log.Debug("Applying mark '%s' to focused container", m)
+	command := NewCommand("mark", "--add").Arg(m.String()).String()
+
+	_, err := RunCommand(ctx, command)
+	if err != nil {
+		return NewMarkError(m.String(), fmt.Errorf("%w: %v", ErrMarkingFailed, err))
+	}
+
+	return nil
 }
 
-// Applies the mark to the currently focused container
-func (m Mark) Apply() error {
-	log.Debug("Applying mark '%s' to focused container", m.ID)
-	command := fmt.Sprintf("mark --add %s", m.ID)
+// Applies the mark to the container with the given ID
+//
+// Sway silently moves a mark already set on another container, such as one
+// left by an earlier setup, so the mark is only taken from another container
+// when replace is set, and fails with ErrMarkCollision otherwise.
+func (m Mark) ApplyTo(ctx context.Context, conID int64, replace bool) error {
+	log.Debug("Applying mark '%s' to container %d", m, conID)
 
-	_, err := RunCommand(command)
+	tree, err := GetTree(ctx)
 	if err != nil {
-		return NewMarkError(m.ID, fmt.Errorf("%w: %v", ErrMarkingFailed, err))
+		return NewMarkError(m.String(), fmt.Errorf("%w: %v", ErrMarkingFailed, err))
+	}
+	if holder := tree.FindMark(m.String()); holder != nil && holder.ID != conID {
+		if !replace {
+			return NewMarkError(m.String(), fmt.Errorf("%w: container %d ('%s')", ErrMarkCollision, holder.ID, holder.Name))
+		}
+		log.Warn("Moving mark '%s' from container %d ('%s') to container %d", m, holder.ID, holder.Name, conID)
+	}
+
+	command := NewCommand("mark", "--add").Arg(m.String()).ForConID(conID).String()
+
+	if _, err := RunCommand(ctx, command); err != nil {
+		return NewMarkError(m.String(), fmt.Errorf("%w: %v", ErrMarkingFailed, err))
 	}
 
 	return nil
 }
 
 // Focuses the container with this mark
-func (m Mark) Focus() error {
-	log.Debug("Focusing container with mark '%s'", m.ID)
-	_, err := RunCommand(m.FocusCmd())
+func (m Mark) Focus(ctx context.Context) error {
+	log.Debug("Focusing container with mark '%s'", m)
+	_, err := RunCommand(ctx, m.FocusCmd())
 	if err != nil {
-		return fmt.Errorf("failed to focus container with mark '%s': %w", m.ID, err)
+		return fmt.Errorf("failed to focus container with mark '%s': %w", m, err)
 	}
 	return nil
 }
 
 // Does the mark represents a top-level workspace app
 func (m Mark) IsWorkspaceApp() bool {
-	return strings.Contains(m.ID, "_app_") && !strings.Contains(m.ID, "_con_")
+	return m.Kind == MarkApp && len(m.Path) == 0
 }
 
 // Does the mark represents an app inside a container
 func (m Mark) IsContainerApp() bool {
-	return strings.Contains(m.ID, "_app_") && strings.Contains(m.ID, "_con_")
+	return m.Kind == MarkApp && len(m.Path) > 0
 }
 
 // Does the mark represents a container
 func (m Mark) IsContainer() bool {
-	return strings.Contains(m.ID, "_con_") && !strings.Contains(m.ID, "_app_")
+	return m.Kind == MarkContainer
 }
 
-// Extracts the workspace name from the mark
-func (m Mark) GetWorkspace() string {
-	parts := strings.Split(m.ID, "_")
-	if len(parts) > 1 {
-		return parts[1]
-	}
-	return ""
+// Does the mark represents a scratchpad app
+func (m Mark) IsScratchpad() bool {
+	return m.Kind == MarkScratchpad
 }
 
 // Retrieves all nodes with marks (for debugging purposes)
-func GetMarkedNodes() ([]Mark, error) {
+func GetMarkedNodes(ctx context.Context) ([]Mark, error) {
 	log.Debug("Getting all marked nodes")
 
-	cmd := exec.Command("swaymsg", "-t", "get_marks", "-r")
+	cmd := exec.CommandContext(ctx, "swaymsg", "-t", "get_marks", "-r")
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
@@ -131,8 +335,8 @@ func GetMarkedNodes() ([]Mark, error) {
 	// Filter for our marks
 	var marks []Mark
 	for _, id := range markIDs {
-		if strings.HasPrefix(id, "ws_") {
-			marks = append(marks, Mark{ID: id})
+		if mark, err := ParseMark(id); err == nil {
+			marks = append(marks, mark)
 		}
 	}
 
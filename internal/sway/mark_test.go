@@ -0,0 +1,186 @@
+package sway
+
+import (
+	"errors"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+)
+
+// Random mark, for property tests
+type randomMark struct {
+	Mark
+}
+
+// Characters over-represented in generated names, as they have a meaning in
+// marks, sway commands or regular expressions
+var markSpecialChars = []rune{':', '%', '.', ' ', '"', '\\', ';', ',', '[', ']', '^', '$', '*', 'é', '日', '😀', '\t', 0}
+
+func randomName(r *rand.Rand) string {
+	var b strings.Builder
+	for range r.Intn(12) {
+		switch r.Intn(3) {
+		case 0:
+			b.WriteRune(markSpecialChars[r.Intn(len(markSpecialChars))])
+		case 1:
+			b.WriteByte(byte('a' + r.Intn(26)))
+		default:
+			b.WriteRune(rune(r.Intn(0x10000)))
+		}
+	}
+	return strings.ToValidUTF8(b.String(), "?")
+}
+
+func (randomMark) Generate(r *rand.Rand, _ int) reflect.Value {
+	var path []int
+	for range r.Intn(4) {
+		path = append(path, r.Intn(20))
+	}
+
+	var m Mark
+	switch r.Intn(4) {
+	case 0:
+		m = NewAppMark(randomName(r), path, r.Intn(20))
+	case 1:
+		m = NewContainerMark(randomName(r), path)
+	case 2:
+		m = NewScratchpadMark(randomName(r))
+	default:
+		m = NewIDMark("x" + randomName(r))
+	}
+	return reflect.ValueOf(randomMark{m})
+}
+
+func TestMarkRoundTrip(t *testing.T) {
+	roundTrips := func(m randomMark) bool {
+		parsed, err := ParseMark(m.String())
+		return err == nil && parsed.Equal(m.Mark)
+	}
+
+	if err := quick.Check(roundTrips, &quick.Config{MaxCount: 20000}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMarkRoundTripNames(t *testing.T) {
+	names := []string{"", "1", "1: web", "a:b:c", "100%", "%41", "%%", "a.b", "..", "日本語", "a b\tc", `"quoted"`, `back\slash`, "[con_mark=x]", "semi;colon,comma", "-_."}
+
+	for _, name := range names {
+		marks := []Mark{
+			NewAppMark(name, nil, 0),
+			NewAppMark(name, []int{3, 0, 12}, 7),
+			NewContainerMark(name, []int{1}),
+			NewScratchpadMark(name),
+		}
+		if name != "" {
+			marks = append(marks, NewIDMark(name))
+		}
+
+		for _, m := range marks {
+			encoded := m.String()
+			parsed, err := ParseMark(encoded)
+			if err != nil {
+				t.Errorf("ParseMark(%q) for %#v: %v", encoded, m, err)
+				continue
+			}
+			if !parsed.Equal(m) {
+				t.Errorf("ParseMark(%q) = %#v, want %#v", encoded, parsed, m)
+			}
+		}
+	}
+}
+
+// Encoded marks only hold characters that need no quoting in sway commands
+func TestMarkEncodingCharacters(t *testing.T) {
+	encodedOnly := func(m randomMark) bool {
+		return strings.IndexFunc(m.String(), func(r rune) bool {
+			return r > 0x7f || !(isMarkChar(byte(r)) || r == ':' || r == '%')
+		}) < 0
+	}
+
+	if err := quick.Check(encodedOnly, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMarkEncoding(t *testing.T) {
+	tests := []struct {
+		mark Mark
+		want string
+	}{
+		{NewAppMark("1", nil, 0), "flem:app:1::0"},
+		{NewAppMark("1: web", []int{2, 1}, 3), "flem:app:1%3A%20web:2.1:3"},
+		{NewContainerMark("dev", []int{0}), "flem:con:dev:0"},
+		{NewScratchpadMark("notes"), "flem:scratchpad:notes"},
+		{NewIDMark("term"), "flem:term"},
+		{NewIDMark("a%b"), "flem:a%25b"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.mark.String(); got != tt.want {
+			t.Errorf("%#v.String() = %q, want %q", tt.mark, got, tt.want)
+		}
+	}
+}
+
+func TestParseMarkRejectsForeignMarks(t *testing.T) {
+	marks := []string{
+		"",
+		"flem",
+		"flem:",
+		"FLEM:app:1::0",
+		"other",
+		"other:flem:x",
+		"ws_1_app_0",
+		"scratchpad_notes",
+		"flem:app:1:0",
+		"flem:app:1::0:0",
+		"flem:app:1::x",
+		"flem:app:1::-1",
+		"flem:app:1::01",
+		"flem:app:1:0..1:0",
+		"flem:app:1:0.:0",
+		"flem:app:1:+1:0",
+		"flem:con:1",
+		"flem:con:1:0:0",
+		"flem:scratchpad:a:b",
+		"flem:unknown:a",
+		"flem:unknown:a:b:c",
+		"flem:a b",
+		"flem:a%3a",
+		"flem:a%4",
+		"flem:%41",
+		"flem:%2E",
+		"flem:é",
+		"flem:con:%ZZ:0",
+	}
+
+	for _, s := range marks {
+		if m, err := ParseMark(s); !errors.Is(err, ErrInvalidMark) {
+			t.Errorf("ParseMark(%q) = %#v, %v, want %v", s, m, err, ErrInvalidMark)
+		}
+	}
+}
+
+// Every mark accepted by ParseMark is in its canonical encoding, so one
+// container never has two marks meaning the same
+func FuzzParseMark(f *testing.F) {
+	for _, seed := range []string{"flem:app:1::0", "flem:app:1%3A%20web:2.1:3", "flem:con:dev:0", "flem:scratchpad:notes", "flem:term", "flem:a%25b", "ws_1_app_0"} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, s string) {
+		m, err := ParseMark(s)
+		if err != nil {
+			if !errors.Is(err, ErrInvalidMark) {
+				t.Fatalf("ParseMark(%q) error = %v, want %v", s, err, ErrInvalidMark)
+			}
+			return
+		}
+		if encoded := m.String(); encoded != s {
+			t.Fatalf("ParseMark(%q) = %#v, encoded back as %q", s, m, encoded)
+		}
+	})
+}
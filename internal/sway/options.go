@@ -0,0 +1,58 @@
+package sway
+
+import (
+	"fmt"
+	"strings"
+)
+
+// How the applications of a workspace are launched
+type LaunchMode string
+
+const (
+	LaunchSequential LaunchMode = "sequential" // One at a time, marking the focused window
+	LaunchParallel   LaunchMode = "parallel"   // All at once, placing windows by mark afterwards
+)
+
+// Parses a string into a LaunchMode
+func ParseLaunchMode(s string) (LaunchMode, error) {
+	switch mode := LaunchMode(strings.ToLower(strings.TrimSpace(s))); mode {
+	case LaunchSequential, LaunchParallel:
+		return mode, nil
+	case "":
+		return LaunchSequential, nil
+	default:
+		return "", fmt.Errorf("%w: '%s' (expected sequential or parallel)", ErrInvalidLaunchMode, s)
+	}
+}
+
+// Options controlling how the environment is set up
+type SetupOptions struct {
+	OnFailure FailurePolicy
+	Launch    LaunchMode
+	Jobs      int // Number of workspaces set up at the same time
+
+	// Where the report is written, exposed to after_all and on_failure hooks
+	// as FLEM_REPORT
+	ReportPath string
+
+	// Mark the focused window when the window of a launched application cannot
+	// be identified, as flem used to (sequential launches only)
+	AllowFocusMark bool
+
+	// Move marks already set on other containers, such as windows of an
+	// earlier setup, instead of failing to mark the new ones
+	ReplaceMarks bool
+
+	// Readiness of the containers other containers depend on, shared by all
+	// workspaces of a setup
+	readiness *readinessTracker
+}
+
+// Returns the options matching the historical behaviour
+func DefaultSetupOptions() SetupOptions {
+	return SetupOptions{
+		OnFailure: FailureKeep,
+		Launch:    LaunchSequential,
+		Jobs:      1,
+	}
+}
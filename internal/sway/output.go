@@ -0,0 +1,145 @@
+package sway
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/titembaatar/sway.flem/internal/config"
+	"github.com/titembaatar/sway.flem/internal/log"
+)
+
+// Output as returned by get_outputs
+type Output struct {
+	Name        string     `json:"name"`
+	Make        string     `json:"make"`
+	Model       string     `json:"model"`
+	Serial      string     `json:"serial"`
+	Active      bool       `json:"active"`
+	Focused     bool       `json:"focused"`
+	Scale       float64    `json:"scale"`
+	Transform   string     `json:"transform"`
+	CurrentMode OutputMode `json:"current_mode"`
+	Rect        Rect       `json:"rect"` // Layout area, scaled and transformed
+}
+
+// Video mode of an output
+type OutputMode struct {
+	Width   int `json:"width"`
+	Height  int `json:"height"`
+	Refresh int `json:"refresh"` // mHz
+}
+
+// Mode of the output as '<width>x<height>'
+func (o Output) Resolution() string {
+	return fmt.Sprintf("%dx%d", o.CurrentMode.Width, o.CurrentMode.Height)
+}
+
+// Orientation of the output once transformed: landscape or portrait
+func (o Output) Orientation() string {
+	if o.Rect.Height > o.Rect.Width {
+		return "portrait"
+	}
+	return "landscape"
+}
+
+// Retrieves the outputs known to sway
+func GetOutputs(ctx context.Context) ([]Output, error) {
+	var outputs []Output
+	if err := executeSwayGetJSON(ctx, "", "get_outputs", &outputs); err != nil {
+		return nil, err
+	}
+	return outputs, nil
+}
+
+// Whether the output satisfies all the criteria that are set
+func (o Output) Matches(match config.OutputMatch) bool {
+	criteria := []struct{ want, got string }{
+		{match.Name, o.Name},
+		{match.Make, o.Make},
+		{match.Model, o.Model},
+		{match.Serial, o.Serial},
+	}
+
+	for _, c := range criteria {
+		if c.want != "" && c.want != c.got {
+			return false
+		}
+	}
+	return true
+}
+
+// Picks the first active output of the list of preferences
+//
+// Returns the output and the index of the preference it matched, or -1 when
+// none of the preferred outputs is connected.
+func ResolveOutput(preferences config.Output, outputs []Output) (Output, int) {
+	for i, match := range preferences {
+		for _, output := range outputs {
+			if output.Active && output.Matches(match) {
+				return output, i
+			}
+		}
+	}
+	return Output{}, -1
+}
+
+// Moves a workspace to its preferred connected output before it is built
+//
+// The workspace is assigned to the output, which places it there when it is
+// created, and moved there if it already exists elsewhere. When none of the
+// outputs is connected, sway is left to place the workspace. Returns the name
+// of the output used, if any. A numbered workspace is found by its number.
+func assignOutput(ctx context.Context, name string, number int, preferences config.Output) (string, error) {
+	outputs, err := GetOutputs(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	output, index := ResolveOutput(preferences, outputs)
+	switch {
+	case index < 0:
+		log.Warn("No output of workspace %s is connected (%s), leaving placement to sway", name, describeOutputs(preferences))
+		return "", nil
+	case index > 0:
+		log.Warn("Preferred output of workspace %s is not connected, using %s", name, output.Name)
+	}
+
+	log.Info("Assigning workspace %s to output %s", name, output.Name)
+
+	assign := NewCommand("workspace").Arg(name).Keyword("output").Arg(output.Name)
+	if _, err := RunCommand(ctx, assign.String()); err != nil {
+		return "", fmt.Errorf("failed to assign workspace to output %s: %w", output.Name, err)
+	}
+
+	tree, err := GetTree(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	workspace := tree.FindWorkspaceNamed(name, number)
+	if workspace == nil {
+		return output.Name, nil
+	}
+
+	// Target the workspace through one of its windows so focus does not
+	// matter; an empty workspace only exists while it is focused
+	move := NewCommand("move", "workspace", "to", "output").Arg(output.Name)
+	if window := workspace.Find((*Node).IsWindow); window != nil {
+		move.ForConID(window.ID)
+	}
+	if _, err := RunCommand(ctx, move.String()); err != nil {
+		return "", fmt.Errorf("failed to move workspace to output %s: %w", output.Name, err)
+	}
+
+	return output.Name, nil
+}
+
+// Lists output preferences for logs
+func describeOutputs(preferences config.Output) string {
+	descriptions := make([]string, len(preferences))
+	for i, match := range preferences {
+		descriptions[i] = match.String()
+	}
+	return strings.Join(descriptions, ", ")
+}
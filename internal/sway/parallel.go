@@ -0,0 +1,342 @@
+package sway
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/titembaatar/sway.flem/internal/config"
+	"github.com/titembaatar/sway.flem/internal/log"
+	"github.com/titembaatar/sway.flem/pkg/types"
+)
+
+// Planned node of a workspace layout, used by parallel launches
+type layoutNode struct {
+	container config.Container
+	mark      Mark
+	children  []*layoutNode
+	window    *Node // Window of the application, once launched
+	err       error // Launch error of the application
+}
+
+func (n *layoutNode) isApp() bool {
+	return n.container.App != ""
+}
+
+// Plans the layout nodes and marks of a list of containers
+//
+// The path holds the positions of the nested containers leading to the list.
+func planLayout(workspaceName string, containers []config.Container, path []int) []*layoutNode {
+	nodes := make([]*layoutNode, 0, len(containers))
+
+	for i, container := range containers {
+		node := &layoutNode{container: container}
+
+		if container.App != "" {
+			node.mark = markForApp(container, workspaceName, path, i)
+		} else {
+			childPath := append(slices.Clone(path), i)
+			node.mark = markForContainer(container, workspaceName, childPath)
+			node.children = planLayout(workspaceName, container.Containers, childPath)
+		}
+
+		nodes = append(nodes, node)
+	}
+
+	return nodes
+}
+
+// Returns the application nodes of a layout, in tree order
+func appNodes(nodes []*layoutNode) []*layoutNode {
+	var apps []*layoutNode
+	for _, node := range nodes {
+		if node.isApp() {
+			apps = append(apps, node)
+		} else {
+			apps = append(apps, appNodes(node.children)...)
+		}
+	}
+	return apps
+}
+
+// Removes the applications without a window, the floating ones, which are not
+// part of the tiled layout, and the containers left empty
+func pruneLayout(nodes []*layoutNode) []*layoutNode {
+	var kept []*layoutNode
+	for _, node := range nodes {
+		if node.isApp() {
+			if node.window != nil && !node.container.Floating {
+				kept = append(kept, node)
+			}
+			continue
+		}
+
+		node.children = pruneLayout(node.children)
+		if len(node.children) > 0 {
+			kept = append(kept, node)
+		}
+	}
+	return kept
+}
+
+// Builds the workspace by launching all applications at once and placing
+// their windows by mark once they have all appeared
+//
+// A detached builder never switches workspace: windows are moved to the
+// workspace by mark, which creates it, so several workspaces can be built at
+// the same time.
+func (b *workspaceBuilder) buildParallel(ctx context.Context, workspace config.Workspace) error {
+	if !b.detached {
+		if err := CreateWorkspace(ctx, b.name, b.number, workspace.Layout.String()); err != nil {
+			return fmt.Errorf("failed to create workspace: %w", err)
+		}
+	}
+
+	nodes := planLayout(b.name, workspace.Containers, nil)
+	apps := appNodes(nodes)
+
+	log.Info("Launching %d applications in parallel", len(apps))
+	opts := LaunchOptions{Workspace: b.name, ReplaceMarks: b.launch.ReplaceMarks, DeferFloating: true}
+	b.launchApps(ctx, apps, opts)
+
+	var launchErr error
+	for _, app := range apps {
+		if app.window != nil {
+			b.recordLaunch(app.mark.String())
+		}
+		if app.err != nil && launchErr == nil {
+			msg := fmt.Sprintf("Failed to launch app container %s", app.container.App)
+			launchErr = b.handleError(ctx, msg, app.err)
+		}
+	}
+	if launchErr != nil {
+		return launchErr
+	}
+
+	var floating []*layoutNode
+	for _, app := range apps {
+		if app.window != nil && app.container.Floating {
+			floating = append(floating, app)
+		}
+	}
+	nodes = pruneLayout(nodes)
+
+	// Floating windows leave the tiled layout at once, so they do not take part
+	// in its placement and sizes
+	for _, app := range floating {
+		if _, err := RunCommand(ctx, app.mark.Command("floating", "enable").String()); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Warn("Failed to make '%s' float: %v", app.container.App, err)
+		}
+	}
+
+	for _, app := range append(appNodes(nodes), floating...) {
+		command := app.mark.Command("move", "container", "to", "workspace").Workspace(b.name, b.number)
+		if _, err := RunCommand(ctx, command.String()); err != nil {
+			return fmt.Errorf("failed to move '%s' to workspace: %w", app.mark, err)
+		}
+	}
+
+	if b.detached {
+		if err := setWorkspaceLayout(ctx, nodes, workspace.Layout); err != nil {
+			return err
+		}
+	}
+
+	if err := b.placeNodes(ctx, nodes); err != nil {
+		return err
+	}
+
+	if err := ResizeWorkspace(ctx, b.name, workspace.Containers); err != nil {
+		return err
+	}
+
+	// Sizes in ppt and anchored positions are relative to the workspace, so
+	// floating windows are sized and positioned once on it
+	for _, app := range floating {
+		if err := applyFloating(ctx, app.mark, app.container); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Warn("Failed to apply floating geometry to '%s': %v", app.container.App, err)
+		}
+	}
+
+	log.Info("Workspace %s setup complete", b.name)
+	return nil
+}
+
+// Sets the layout of the workspace holding the windows of the layout, through
+// one of its top-level windows
+func setWorkspaceLayout(ctx context.Context, nodes []*layoutNode, layout types.LayoutType) error {
+	apps := appNodes(nodes)
+	if len(apps) == 0 {
+		return nil
+	}
+
+	// The layout command applies to the parent of a window, here the workspace
+	if _, err := RunCommand(ctx, apps[0].mark.Command(layout.Command()).String()); err != nil {
+		return fmt.Errorf("%w: failed to set layout '%s': %v", ErrWorkspaceCreateFailed, layout, err)
+	}
+	return nil
+}
+
+// Launches the applications concurrently and waits for all of their windows
+func (b *workspaceBuilder) launchApps(ctx context.Context, apps []*layoutNode, opts LaunchOptions) {
+	var wg sync.WaitGroup
+
+	for _, app := range apps {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			window, err := b.launchContainer(ctx, app.container, app.mark, opts)
+			if err != nil {
+				app.err = fmt.Errorf("failed to launch app %s: %w", app.container.App, err)
+				return
+			}
+			app.window = window
+		}()
+	}
+
+	wg.Wait()
+}
+
+// Step of the placement of a layout: a window moved right after another, or
+// split into a nested container
+type placeStep struct {
+	mark   string      // Window the step applies to
+	anchor string      // Window it is moved after, for moves
+	split  *layoutNode // Nested container, for splits
+}
+
+// Plans the placement of the nodes of a level, the first one staying where it
+// is and the others following it
+//
+// sway moves a window to a marked window as its next sibling, but into a
+// marked container as its last child. Windows are thus only moved next to
+// windows: each node of a level stands for its first window, which is placed
+// in order, then nested containers are split around that window and filled
+// the same way. No window needs to be swapped, as every move puts a window at
+// its final position among the ones already placed.
+func planPlacement(nodes []*layoutNode) []placeStep {
+	var steps []placeStep
+
+	prev := ""
+	for _, node := range nodes {
+		first := firstWindow(node)
+		if prev != "" {
+			steps = append(steps, placeStep{mark: first, anchor: prev})
+		}
+		prev = first
+	}
+
+	for _, node := range nodes {
+		if node.isApp() {
+			continue
+		}
+		steps = append(steps, placeStep{mark: firstWindow(node), split: node})
+		steps = append(steps, planPlacement(node.children)...)
+	}
+
+	return steps
+}
+
+// Mark of the first window of a node
+func firstWindow(node *layoutNode) string {
+	for !node.isApp() {
+		node = node.children[0]
+	}
+	return node.mark.String()
+}
+
+// Places the windows of a pruned layout on its workspace
+func (b *workspaceBuilder) placeNodes(ctx context.Context, nodes []*layoutNode) error {
+	for _, step := range planPlacement(nodes) {
+		if step.split != nil {
+			if err := b.splitAround(ctx, step.mark, step.split); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := moveAfterMark(ctx, step.mark, step.anchor); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Splits the first window of a nested container, creating the container
+func (b *workspaceBuilder) splitAround(ctx context.Context, first string, node *layoutNode) error {
+	layout, err := types.ParseLayoutType(node.container.Split.String())
+	if err != nil {
+		return fmt.Errorf("%w: '%s' is not a valid layout type", ErrInvalidLayout, node.container.Split)
+	}
+
+	splitCmd := NewCommand(layout.SplitCommand()).ForMark(first)
+	if _, err := RunCommand(ctx, splitCmd.String()); err != nil {
+		return fmt.Errorf("failed to split '%s': %w", first, err)
+	}
+
+	// The split wrapped the first window in a new container, which now stands
+	// for the nested container and carries its mark
+	placed := first
+	marked, err := markParent(ctx, first, node.mark, b.launch.ReplaceMarks)
+	if err != nil {
+		return err
+	}
+	if marked {
+		b.tx.RecordMark(node.mark.String())
+		placed = node.mark.String()
+	}
+
+	if layout == types.LayoutTabbed || layout == types.LayoutStacking {
+		layoutCmd := NewCommand(layout.Command()).ForMark(placed)
+		if _, err := RunCommand(ctx, layoutCmd.String()); err != nil {
+			return fmt.Errorf("failed to set layout of '%s': %w", placed, err)
+		}
+	}
+
+	return nil
+}
+
+// Moves the container with the given mark right after the anchor mark
+func moveAfterMark(ctx context.Context, mark, anchor string) error {
+	if anchor == "" {
+		return nil
+	}
+
+	command := NewCommand("move", "container", "to", "mark").Arg(anchor).ForMark(mark)
+	if _, err := RunCommand(ctx, command.String()); err != nil {
+		return fmt.Errorf("failed to move '%s' next to '%s': %w", mark, anchor, err)
+	}
+	return nil
+}
+
+// Applies a mark to the parent of the container with the given mark
+//
+// Returns false when the parent is the workspace itself, which cannot be marked.
+func markParent(ctx context.Context, childMark string, mark Mark, replace bool) (bool, error) {
+	tree, err := GetTree(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	child := tree.FindMark(childMark)
+	if child == nil {
+		return false, fmt.Errorf("no container with mark '%s'", childMark)
+	}
+
+	parent := tree.FindParent(child.ID)
+	if parent == nil || parent.Type != "con" {
+		log.Debug("Parent of '%s' is not a container, not applying mark '%s'", childMark, mark)
+		return false, nil
+	}
+
+	if err := mark.ApplyTo(ctx, parent.ID, replace); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,160 @@
+package sway
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/titembaatar/sway.flem/internal/config"
+	"github.com/titembaatar/sway.flem/pkg/types"
+)
+
+// Model of the sway tree, following how placement commands change it
+type modelNode struct {
+	name     string // Application of a window, empty for containers
+	layout   types.LayoutType
+	parent   *modelNode
+	children []*modelNode
+}
+
+func (n *modelNode) index() int {
+	return slices.Index(n.parent.children, n)
+}
+
+// Removes the node from its parent, sway removing containers left empty
+func (n *modelNode) detach() {
+	parent := n.parent
+	parent.children = slices.Delete(parent.children, n.index(), n.index()+1)
+	n.parent = nil
+	if len(parent.children) == 0 && parent.parent != nil {
+		parent.detach()
+	}
+}
+
+func (n *modelNode) String() string {
+	if n.name != "" {
+		return n.name
+	}
+	var parts []string
+	for _, child := range n.children {
+		parts = append(parts, child.String())
+	}
+	return string(n.layout) + "[" + strings.Join(parts, " ") + "]"
+}
+
+// Runs placement steps on the model
+//
+// sway moves a window to a marked window as its next sibling, and splits a
+// window by wrapping it in a new container, unless it is the only child of its
+// parent, whose layout then changes.
+func runPlacement(t *testing.T, windows map[string]*modelNode, steps []placeStep) {
+	t.Helper()
+
+	for _, step := range steps {
+		window := windows[step.mark]
+		if window == nil {
+			t.Fatalf("step applies to %s, which is not a window", step.mark)
+		}
+
+		if step.split != nil {
+			parent := window.parent
+			if len(parent.children) == 1 {
+				parent.layout = step.split.container.Split
+				continue
+			}
+			con := &modelNode{layout: step.split.container.Split, parent: parent, children: []*modelNode{window}}
+			parent.children[window.index()] = con
+			window.parent = con
+			continue
+		}
+
+		// A marked container would take the window as its last child instead
+		anchor := windows[step.anchor]
+		if anchor == nil {
+			t.Fatalf("step moves %s next to %s, which is not a window", step.mark, step.anchor)
+		}
+		window.detach()
+		parent := anchor.parent
+		parent.children = slices.Insert(parent.children, anchor.index()+1, window)
+		window.parent = parent
+	}
+}
+
+func appContainer(name string) config.Container {
+	return config.Container{App: name}
+}
+
+func splitContainer(layout types.LayoutType, containers ...config.Container) config.Container {
+	return config.Container{Split: layout, Containers: containers}
+}
+
+func TestPlanPlacement(t *testing.T) {
+	h, v := types.LayoutHorizontal, types.LayoutVertical
+
+	tests := []struct {
+		name       string
+		containers []config.Container
+		want       string
+	}{
+		{
+			"flat",
+			[]config.Container{appContainer("a"), appContainer("b"), appContainer("c")},
+			"splith[a b c]",
+		},
+		{
+			"sibling after a nested container",
+			[]config.Container{appContainer("a"), splitContainer(v, appContainer("b"), appContainer("c")), appContainer("d")},
+			"splith[a splitv[b c] d]",
+		},
+		{
+			"nested containers first and last",
+			[]config.Container{splitContainer(v, appContainer("a"), splitContainer(h, appContainer("b"), appContainer("c"))), appContainer("d"), splitContainer(v, appContainer("e"), appContainer("f"))},
+			"splith[splitv[a splith[b c]] d splitv[e f]]",
+		},
+		{
+			"single nested container",
+			[]config.Container{splitContainer(v, splitContainer(h, appContainer("a"), appContainer("b")), appContainer("c"))},
+			"splith[splitv[splith[a b] c]]",
+		},
+		{
+			"tabbed containers side by side",
+			[]config.Container{splitContainer(types.LayoutTabbed, appContainer("a"), appContainer("b")), splitContainer(types.LayoutStacking, appContainer("c"), appContainer("d"))},
+			"splith[tabbed[a b] stacking[c d]]",
+		},
+	}
+
+	for _, tt := range tests {
+		nodes := planLayout("dev", tt.containers, nil)
+		for _, node := range appNodes(nodes) {
+			node.window = &Node{}
+		}
+		nodes = pruneLayout(nodes)
+		apps := appNodes(nodes)
+
+		reversed := slices.Clone(apps)
+		slices.Reverse(reversed)
+
+		// Windows appear on the workspace in any order
+		orders := map[string][]*layoutNode{
+			"in order":   apps,
+			"reversed":   reversed,
+			"first last": append(slices.Clone(apps[1:]), apps[0]),
+		}
+		for order, launched := range orders {
+			t.Run(tt.name+"/"+order, func(t *testing.T) {
+				root := &modelNode{layout: h}
+				windows := make(map[string]*modelNode)
+				for _, node := range launched {
+					window := &modelNode{name: node.container.App, parent: root}
+					root.children = append(root.children, window)
+					windows[node.mark.String()] = window
+				}
+
+				runPlacement(t, windows, planPlacement(nodes))
+				if got := root.String(); got != tt.want {
+					t.Errorf("placed %s, want %s", got, tt.want)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package sway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/titembaatar/sway.flem/internal/config"
+	"github.com/titembaatar/sway.flem/internal/log"
+)
+
+// Time a readiness probe is retried when no timeout is configured
+const defaultProbeTimeout = 30 * time.Second
+
+// Time between two attempts of a readiness probe
+const probePollInterval = 250 * time.Millisecond
+
+// Time a single connection attempt of a probe may take
+const probeDialTimeout = time.Second
+
+// Describes a readiness probe for logs and errors
+func describeProbe(probe config.Probe) string {
+	switch {
+	case probe.TCP != 0:
+		return fmt.Sprintf("tcp port %d", probe.TCP)
+	case probe.Socket != "":
+		return fmt.Sprintf("socket %s", probe.Socket)
+	case probe.File != "":
+		return fmt.Sprintf("file %s", probe.File)
+	case probe.Cmd != "":
+		return fmt.Sprintf("command '%s'", probe.Cmd)
+	default:
+		return fmt.Sprintf("title matching '%s'", probe.Title)
+	}
+}
+
+// Retries a readiness probe against a launched window until it succeeds
+//
+// Returns ErrProbeTimeout, wrapping the last failure, once the probe timeout
+// is reached.
+func runProbe(ctx context.Context, probe config.Probe, window *Node) error {
+	timeout := defaultProbeTimeout
+	if probe.Timeout != 0 {
+		timeout = time.Duration(probe.Timeout) * time.Second
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	check, err := probeCheck(probe, window)
+	if err != nil {
+		return err
+	}
+
+	log.Debug("Waiting up to %s for %s", timeout, describeProbe(probe))
+
+	var lastErr error
+	for probeCtx.Err() == nil {
+		if lastErr = check(probeCtx); lastErr == nil {
+			log.Debug("Readiness probe succeeded: %s", describeProbe(probe))
+			return nil
+		}
+		_ = sleep(probeCtx, probePollInterval)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: %s after %s: %v", ErrProbeTimeout, describeProbe(probe), timeout, lastErr)
+}
+
+// Returns a single attempt of the probe
+func probeCheck(probe config.Probe, window *Node) (func(context.Context) error, error) {
+	switch {
+	case probe.TCP != 0:
+		address := net.JoinHostPort("localhost", strconv.Itoa(probe.TCP))
+		return func(ctx context.Context) error { return dial(ctx, "tcp", address) }, nil
+
+	case probe.Socket != "":
+		return func(ctx context.Context) error { return dial(ctx, "unix", probe.Socket) }, nil
+
+	case probe.File != "":
+		return func(context.Context) error {
+			_, err := os.Stat(probe.File)
+			return err
+		}, nil
+
+	case probe.Cmd != "":
+		return func(ctx context.Context) error {
+			cmd := exec.CommandContext(ctx, "sh", "-c", probe.Cmd)
+			cmd.WaitDelay = hookWaitDelay
+			return cmd.Run()
+		}, nil
+
+	case probe.Title != "":
+		pattern, err := regexp.Compile(probe.Title)
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context) error { return checkTitle(ctx, pattern, window) }, nil
+
+	default:
+		return nil, errors.New("readiness probe has no check")
+	}
+}
+
+// Opens and closes a connection to the address
+func dial(ctx context.Context, network, address string) error {
+	dialer := net.Dialer{Timeout: probeDialTimeout}
+	conn, err := dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// Checks that the title of the window matches the pattern
+func checkTitle(ctx context.Context, pattern *regexp.Regexp, window *Node) error {
+	tree, err := GetTree(ctx)
+	if err != nil {
+		return err
+	}
+
+	current := tree.Find(func(n *Node) bool { return n.ID == window.ID })
+	if current == nil {
+		return fmt.Errorf("window %d is gone", window.ID)
+	}
+	if !pattern.MatchString(current.Name) {
+		return fmt.Errorf("title '%s' does not match", current.Name)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package sway
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Parent and process group of a process, read from /proc
+type procStat struct {
+	ppid int
+	pgid int
+}
+
+// Reads the parent and process group of a process
+func readProcStat(pid int) (procStat, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return procStat{}, err
+	}
+
+	// The command name is in parentheses and may itself contain spaces or
+	// parentheses, so fields are read after the last closing one
+	stat := string(data)
+	end := strings.LastIndexByte(stat, ')')
+	if end < 0 {
+		return procStat{}, fmt.Errorf("malformed stat for process %d", pid)
+	}
+
+	// state ppid pgrp ...
+	fields := strings.Fields(stat[end+1:])
+	if len(fields) < 3 {
+		return procStat{}, fmt.Errorf("malformed stat for process %d", pid)
+	}
+
+	ppid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return procStat{}, fmt.Errorf("malformed parent of process %d: %w", pid, err)
+	}
+	pgid, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return procStat{}, fmt.Errorf("malformed process group of process %d: %w", pid, err)
+	}
+
+	return procStat{ppid: ppid, pgid: pgid}, nil
+}
+
+// Whether a process belongs to the process tree started by root
+//
+// That is root itself, one of its descendants, or a process of the group root
+// leads: launched applications get their own process group, so children that
+// were forked and reparented after their parent exited are still recognized.
+func inProcessTree(pid, root int) bool {
+	if pid <= 0 || root <= 0 {
+		return false
+	}
+
+	for current := pid; current > 1; {
+		if current == root {
+			return true
+		}
+
+		stat, err := readProcStat(current)
+		if err != nil {
+			return false
+		}
+		if stat.pgid == root {
+			return true
+		}
+		current = stat.ppid
+	}
+
+	return false
+}
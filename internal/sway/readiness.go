@@ -0,0 +1,162 @@
+package sway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/titembaatar/sway.flem/internal/config"
+	"github.com/titembaatar/sway.flem/internal/log"
+)
+
+// Container other containers may depend on
+type dependency struct {
+	workspace string
+	probe     config.Probe
+	started   bool          // Whether the application was launched
+	done      chan struct{} // Closed once the container is ready or failed
+	err       error
+}
+
+// Tracks when the containers with an id are ready, for their dependents
+//
+// A nil tracker has no containers and never waits.
+type readinessTracker struct {
+	mu   sync.Mutex
+	deps map[string]*dependency
+}
+
+// Creates a tracker for the containers of the configuration with an id
+func newReadinessTracker(cfg *config.Config) *readinessTracker {
+	t := &readinessTracker{deps: make(map[string]*dependency)}
+	for id, ref := range cfg.ContainerIDs() {
+		t.deps[id] = &dependency{
+			workspace: ref.Workspace,
+			probe:     ref.Container.Ready,
+			done:      make(chan struct{}),
+		}
+	}
+	return t
+}
+
+// Waits until the containers with the given ids are ready
+//
+// Fails as soon as one of them failed to launch or to become ready, or is not
+// part of the setup.
+func (t *readinessTracker) wait(ctx context.Context, ids []string) error {
+	if t == nil {
+		return nil
+	}
+
+	for _, id := range ids {
+		dep, found := t.deps[id]
+		if !found {
+			return NewDependencyError(id, ErrUnknownDependency)
+		}
+
+		select {
+		case <-dep.done:
+		default:
+			log.Info("Waiting for dependency '%s'", id)
+		}
+
+		select {
+		case <-dep.done:
+			if dep.err != nil {
+				return NewDependencyError(id, dep.err)
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+// Records the launch of a container, which is ready once its probe succeeds
+//
+// The probe runs in the background so the rest of the workspace is not held
+// back by it.
+func (t *readinessTracker) launched(ctx context.Context, id string, window *Node) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	dep, found := t.deps[id]
+	if found {
+		dep.started = true
+	}
+	t.mu.Unlock()
+	if !found {
+		return
+	}
+
+	if dep.probe.IsEmpty() {
+		t.resolve(id, nil)
+		return
+	}
+
+	go func() {
+		err := runProbe(ctx, dep.probe, window)
+		if err != nil && ctx.Err() == nil {
+			log.Warn("Container '%s' did not become ready: %v", id, err)
+		}
+		t.resolve(id, err)
+	}()
+}
+
+// Records that a container failed to launch
+func (t *readinessTracker) failed(id string, err error) {
+	if t == nil {
+		return
+	}
+	t.resolve(id, err)
+}
+
+// Fails the containers of a workspace that were never launched
+func (t *readinessTracker) abandon(workspace string, err error) {
+	if t == nil {
+		return
+	}
+
+	if err == nil {
+		err = errors.New("container was not launched")
+	}
+
+	t.mu.Lock()
+	var pending []string
+	for id, dep := range t.deps {
+		if dep.workspace == workspace && !dep.started {
+			pending = append(pending, id)
+		}
+	}
+	t.mu.Unlock()
+
+	for _, id := range pending {
+		t.resolve(id, err)
+	}
+}
+
+// Marks a container as ready, or failed when err is set, once
+func (t *readinessTracker) resolve(id string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	dep, found := t.deps[id]
+	if !found {
+		return
+	}
+
+	select {
+	case <-dep.done:
+		return
+	default:
+	}
+
+	if err != nil {
+		dep.err = fmt.Errorf("%w: %w", ErrDependencyFailed, err)
+	}
+	close(dep.done)
+}
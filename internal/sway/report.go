@@ -0,0 +1,205 @@
+package sway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Outcome of a workspace setup
+type WorkspaceStatus string
+
+const (
+	WorkspacePending   WorkspaceStatus = "pending"
+	WorkspaceRunning   WorkspaceStatus = "running"
+	WorkspaceComplete  WorkspaceStatus = "complete"
+	WorkspaceFailed    WorkspaceStatus = "failed"
+	WorkspaceCancelled WorkspaceStatus = "cancelled"
+)
+
+// What happened while setting up a single workspace
+type WorkspaceReport struct {
+	Name       string          `json:"name"`
+	Status     WorkspaceStatus `json:"status"`
+	Output     string          `json:"output,omitempty"` // Output the workspace was assigned to
+	Marks      []string        `json:"marks,omitempty"`  // Marks of the applications launched
+	Errors     []string        `json:"errors,omitempty"` // Errors that did not stop the setup
+	RolledBack bool            `json:"rolled_back,omitempty"`
+	Hooks      []HookResult    `json:"hooks,omitempty"`
+	Duration   time.Duration   `json:"duration"`
+}
+
+// What happened during a whole environment setup
+type SetupReport struct {
+	StartTime  time.Time          `json:"start_time"`
+	Duration   time.Duration      `json:"duration"`
+	Workspaces []*WorkspaceReport `json:"workspaces"`
+	Scratchpad *WorkspaceReport   `json:"scratchpad,omitempty"`
+	Hooks      []HookResult       `json:"hooks,omitempty"`
+	Error      string             `json:"error,omitempty"`
+}
+
+// Creates a report with the given workspaces pending, in order, by their
+// name in sway
+func NewSetupReport(workspaces []string) *SetupReport {
+	report := &SetupReport{StartTime: time.Now()}
+	for _, name := range workspaces {
+		report.AddWorkspace(name)
+	}
+	return report
+}
+
+// Registers a pending workspace in the report
+func (r *SetupReport) AddWorkspace(name string) *WorkspaceReport {
+	ws := &WorkspaceReport{Name: name, Status: WorkspacePending}
+	r.Workspaces = append(r.Workspaces, ws)
+	return ws
+}
+
+// Records the end of the setup and its error, if any
+func (r *SetupReport) Finish(err error) {
+	r.Duration = time.Since(r.StartTime)
+	if err != nil {
+		r.Error = err.Error()
+	}
+}
+
+// Whether a workspace or a hook failed
+func (r *SetupReport) Failed() bool {
+	if r.Error != "" {
+		return true
+	}
+	for _, ws := range r.all() {
+		if ws.Status == WorkspaceFailed || ws.Status == WorkspaceCancelled {
+			return true
+		}
+	}
+	return false
+}
+
+// Writes the report as JSON, creating the parent directory if needed
+func (r *SetupReport) WriteFile(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create report directory: %w", err)
+	}
+
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
+
+// Whether the setup was stopped before every workspace was processed
+func (r *SetupReport) Interrupted() bool {
+	for _, ws := range r.Workspaces {
+		if ws.Status == WorkspacePending || ws.Status == WorkspaceRunning || ws.Status == WorkspaceCancelled {
+			return true
+		}
+	}
+	return false
+}
+
+// Writes a human readable summary of the report
+func (r *SetupReport) Print(w io.Writer) {
+	state := "completed"
+	if r.Interrupted() {
+		state = "interrupted"
+	}
+	fmt.Fprintf(w, "Setup %s after %.2fs:\n", state, r.Duration.Seconds())
+
+	width := 0
+	for _, ws := range r.all() {
+		width = max(width, len(ws.Name))
+	}
+
+	for _, ws := range r.all() {
+		line := fmt.Sprintf("  %-*s  %-9s", width, ws.Name, ws.Status)
+
+		var details []string
+		if len(ws.Marks) > 0 {
+			details = append(details, pluralize(len(ws.Marks), "app"))
+		}
+		if len(ws.Errors) > 0 {
+			details = append(details, pluralize(len(ws.Errors), "error"))
+		}
+		if ws.RolledBack {
+			details = append(details, "rolled back")
+		}
+		if len(details) > 0 {
+			line += "  " + strings.Join(details, ", ")
+		}
+		fmt.Fprintln(w, strings.TrimRight(line, " "))
+
+		for _, msg := range ws.Errors {
+			fmt.Fprintf(w, "  %-*s    - %s\n", width, "", msg)
+		}
+		printFailedHooks(w, fmt.Sprintf("  %-*s    ", width, ""), ws.Hooks)
+	}
+
+	printFailedHooks(w, "  ", r.Hooks)
+
+	if r.Error != "" {
+		fmt.Fprintf(w, "Error: %s\n", r.Error)
+	}
+}
+
+// Returns the workspace reports, preceded by the scratchpad one if any
+func (r *SetupReport) all() []*WorkspaceReport {
+	if r.Scratchpad == nil {
+		return r.Workspaces
+	}
+	return append([]*WorkspaceReport{r.Scratchpad}, r.Workspaces...)
+}
+
+// Records a mark applied to a launched application
+func (w *WorkspaceReport) AddMark(mark string) {
+	w.Marks = append(w.Marks, mark)
+}
+
+// Records an error that did not stop the workspace setup
+func (w *WorkspaceReport) AddError(err error) {
+	w.Errors = append(w.Errors, err.Error())
+}
+
+// Records the final status of the workspace from the setup result
+func (w *WorkspaceReport) finish(start time.Time, err error) {
+	w.Duration = time.Since(start)
+
+	switch {
+	case err == nil:
+		w.Status = WorkspaceComplete
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		w.Status = WorkspaceCancelled
+		w.AddError(err)
+	default:
+		w.Status = WorkspaceFailed
+		w.AddError(err)
+	}
+}
+
+// Writes a line for each failed hook
+func printFailedHooks(w io.Writer, indent string, hooks []HookResult) {
+	for _, hook := range hooks {
+		if hook.Error != "" {
+			fmt.Fprintf(w, "%s- %s hook '%s' failed: %s\n", indent, hook.Stage, hook.Command, hook.Error)
+		}
+	}
+}
+
+func pluralize(n int, word string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, word)
+	}
+	return fmt.Sprintf("%d %ss", n, word)
+}
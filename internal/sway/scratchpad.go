@@ -0,0 +1,131 @@
+package sway
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/titembaatar/sway.flem/internal/config"
+	"github.com/titembaatar/sway.flem/internal/log"
+)
+
+// Name under which the scratchpad appears in the setup report
+const scratchpadReportName = "scratchpad"
+
+// Launches the applications of the scratchpad section and hides them in the
+// scratchpad
+//
+// Applications still running from an earlier setup, found by their mark, are
+// left alone. Returns an error only when the setup must stop.
+func setupScratchpad(ctx context.Context, cfg *config.Config, report *SetupReport, opts SetupOptions) error {
+	if len(cfg.Scratchpad) == 0 {
+		return nil
+	}
+
+	log.Info("Setting up %d scratchpad applications", len(cfg.Scratchpad))
+
+	wsReport := &WorkspaceReport{Name: scratchpadReportName, Status: WorkspaceRunning}
+	report.Scratchpad = wsReport
+	start := time.Now()
+
+	b := &workspaceBuilder{
+		name:   scratchpadReportName,
+		policy: opts.OnFailure,
+		launch: LaunchOptions{
+			WaitDelay:      true,
+			AllowFocusMark: opts.AllowFocusMark,
+			ReplaceMarks:   opts.ReplaceMarks,
+		},
+		report: wsReport,
+		tx:     NewTransaction(scratchpadReportName),
+	}
+
+	err := b.buildScratchpad(ctx, cfg.Scratchpad)
+	if err != nil && b.policy == FailureRollback {
+		if rbErr := b.tx.Rollback(ctx); rbErr != nil {
+			log.Error("Failed to roll back scratchpad: %v", rbErr)
+			wsReport.AddError(rbErr)
+		} else {
+			wsReport.RolledBack = true
+		}
+	}
+	wsReport.finish(start, err)
+
+	switch {
+	case err == nil:
+		return nil
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case opts.OnFailure == FailureAbort:
+		return fmt.Errorf("aborted at scratchpad: %w", err)
+	default:
+		log.Error("Failed to set up scratchpad: %v", err)
+		return nil
+	}
+}
+
+// Launches the scratchpad applications in name order
+func (b *workspaceBuilder) buildScratchpad(ctx context.Context, entries map[string]config.Container) error {
+	tree, err := GetTree(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(entries)) {
+		mark := NewScratchpadMark(name)
+		if tree.FindMark(mark.String()) != nil {
+			log.Info("Scratchpad application '%s' is already running", name)
+			continue
+		}
+
+		if err := b.launchScratchpad(ctx, entries[name], mark); err != nil {
+			msg := fmt.Sprintf("Failed to set up scratchpad application %s", name)
+			if err := b.handleError(ctx, msg, err); err != nil {
+				return err
+			}
+		}
+	}
+
+	log.Info("Scratchpad setup complete")
+	return nil
+}
+
+// Launches a scratchpad application and moves it to the scratchpad
+func (b *workspaceBuilder) launchScratchpad(ctx context.Context, app config.Container, mark Mark) error {
+	// Floating geometry is applied by LaunchApp, before the window is hidden
+	app.Floating = true
+
+	if _, err := LaunchApp(ctx, app, mark, b.launch); err != nil {
+		return fmt.Errorf("failed to launch app %s: %w", app.App, err)
+	}
+	b.recordLaunch(mark.String())
+
+	if _, err := RunCommand(ctx, mark.Command("move", "scratchpad").String()); err != nil {
+		return fmt.Errorf("failed to move '%s' to the scratchpad: %w", mark, err)
+	}
+
+	return nil
+}
+
+// Shows the scratchpad application with the given name, or hides it when it
+// is already visible
+func ToggleScratchpad(ctx context.Context, name string) error {
+	mark := NewScratchpadMark(name)
+
+	tree, err := GetTree(ctx)
+	if err != nil {
+		return err
+	}
+	if tree.FindMark(mark.String()) == nil {
+		return fmt.Errorf("%w: '%s'", ErrScratchpadNotFound, name)
+	}
+
+	log.Debug("Toggling scratchpad application '%s'", name)
+	if _, err := RunCommand(ctx, mark.Command("scratchpad", "show").String()); err != nil {
+		return fmt.Errorf("failed to toggle '%s': %w", name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,332 @@
+package sway
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/titembaatar/sway.flem/internal/config"
+	"github.com/titembaatar/sway.flem/internal/log"
+	"github.com/titembaatar/sway.flem/pkg/types"
+)
+
+// Passes of resizes over the splits of a workspace before giving up on
+// reaching the configured sizes
+const maxResizePasses = 4
+
+// Share of its parent left to each container without a size when the sizes
+// of its siblings would leave it nothing, in ppt
+const minUnsizedShare = 5
+
+// Difference with the target size still considered as reached, in pixels
+const resizeTolerance = 2
+
+// Containers of the configuration sharing a parent, identified by mark
+type sizeGroup struct {
+	marks []Mark
+	sizes []types.Size
+}
+
+// Returns the groups of tiled siblings of a list of containers that have at
+// least one size set, parents before children
+//
+// The path holds the positions of the nested containers leading to the list,
+// as for the marks set by the builders.
+func sizeGroups(workspaceName string, containers []config.Container, path []int) []sizeGroup {
+	var group sizeGroup
+	var nested []sizeGroup
+	sized := false
+
+	for i, container := range containers {
+		if container.Floating {
+			continue
+		}
+
+		// Validated along with the configuration
+		size, _ := types.ParseSize(container.Size)
+		sized = sized || !size.IsEmpty()
+
+		if container.App != "" {
+			group.marks = append(group.marks, markForApp(container, workspaceName, path, i))
+		} else {
+			childPath := append(slices.Clone(path), i)
+			group.marks = append(group.marks, markForContainer(container, workspaceName, childPath))
+			nested = append(nested, sizeGroups(workspaceName, container.Containers, childPath)...)
+		}
+		group.sizes = append(group.sizes, size)
+	}
+
+	if !sized {
+		return nested
+	}
+	return append([]sizeGroup{group}, nested...)
+}
+
+// Resizes the containers of a workspace to their configured sizes
+//
+// Setting the size of a container in sway takes the space from both of its
+// neighbours, undoing the sizes set before it. Instead, the sizes of the
+// whole split are solved first, then each container but the last is moved by
+// its edge towards the next one, from the first to the last, so each resize
+// only changes containers not yet at their target. Outer splits come first,
+// as their sizes change the space of inner ones, and passes are repeated
+// until the rects of the tree match the targets.
+func ResizeWorkspace(ctx context.Context, workspaceName string, containers []config.Container) error {
+	groups := sizeGroups(workspaceName, containers, nil)
+	if len(groups) == 0 {
+		return nil
+	}
+
+	log.Info("Resizing %d splits of workspace %s", len(groups), workspaceName)
+
+	for pass := 1; pass <= maxResizePasses+1; pass++ {
+		settled := true
+		for _, group := range groups {
+			done, err := resizeGroup(ctx, group, pass <= maxResizePasses)
+			if err != nil {
+				return err
+			}
+			settled = settled && done
+		}
+
+		if settled {
+			log.Debug("Sizes of workspace %s settled after %d passes", workspaceName, pass-1)
+			return nil
+		}
+	}
+
+	log.Warn("Sizes of workspace %s still differ from the configuration after %d passes", workspaceName, maxResizePasses)
+	return nil
+}
+
+// Resizes the children of the split holding a group towards their target
+// sizes, unless apply is false, and returns whether they were already there
+func resizeGroup(ctx context.Context, group sizeGroup, apply bool) (bool, error) {
+	tree, err := GetTree(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	parent, sizes := locateGroup(tree, group)
+	if parent == nil {
+		return true, nil
+	}
+
+	// Tabbed and stacked children all take the whole parent
+	layoutType, err := types.ParseLayoutType(parent.Layout)
+	if err != nil || (layoutType != types.LayoutHorizontal && layoutType != types.LayoutVertical) {
+		return true, nil
+	}
+	dimension, edge := "width", "right"
+	if layoutType == types.LayoutVertical {
+		dimension, edge = "height", "down"
+	}
+
+	current := make([]int, len(parent.Nodes))
+	total := 0
+	for i, child := range parent.Nodes {
+		current[i] = child.Rect.Width
+		if dimension == "height" {
+			current[i] = child.Rect.Height
+		}
+		total += current[i]
+	}
+	targets := solveSizes(sizes, total)
+
+	steps := planResizes(current, targets)
+	for _, step := range steps {
+		child := parent.Nodes[step.index]
+		if !apply {
+			log.Debug("Container %d is %d px %s instead of %d px", child.ID, current[step.index], dimension, targets[step.index])
+			continue
+		}
+
+		if err := resizeContainer(ctx, child.ID, edge, step.delta, parent.Layout); err != nil {
+			if ctx.Err() != nil {
+				return false, ctx.Err()
+			}
+			log.Warn("%v", err)
+		}
+	}
+
+	return len(steps) == 0, nil
+}
+
+// Move of the edge of a child of a split towards its next sibling, in pixels
+type resizeStep struct {
+	index int
+	delta int
+}
+
+// Returns the moves bringing the children of a split from their current
+// sizes to their targets, from the first to the one before last
+//
+// Each move takes its space from the next sibling only, and the last child
+// takes what its siblings leave. Children within resizeTolerance of their
+// target are left alone, so a split at its targets needs no move.
+func planResizes(current, targets []int) []resizeStep {
+	sizes := slices.Clone(current)
+
+	var steps []resizeStep
+	for i := 0; i < len(sizes)-1; i++ {
+		delta := targets[i] - sizes[i]
+		if abs(delta) <= resizeTolerance {
+			continue
+		}
+		steps = append(steps, resizeStep{index: i, delta: delta})
+		sizes[i] += delta
+		sizes[i+1] -= delta
+	}
+	return steps
+}
+
+// Returns the split holding the containers of a group in the tree, along
+// with the size of each of its children, empty for those without one or not
+// launched by flem
+//
+// The split is the closest common ancestor of the marked containers; a
+// nested container may carry its mark on its first window, so each child of
+// the split is the ancestor of a mark just below it. Groups with fewer than
+// two containers in the tree are left alone.
+func locateGroup(tree *Node, group sizeGroup) (*Node, []types.Size) {
+	var chains [][]*Node
+	var sizes []types.Size
+	for i, mark := range group.marks {
+		node := tree.FindMark(mark.String())
+		if node == nil {
+			log.Debug("Skipping size of '%s': not in the tree", mark)
+			continue
+		}
+		chain := tree.ancestors(node.ID)
+		if chain == nil {
+			log.Debug("Skipping size of '%s': not tiled", mark)
+			continue
+		}
+		chains = append(chains, chain)
+		sizes = append(sizes, group.sizes[i])
+	}
+	if len(chains) < 2 {
+		return nil, nil
+	}
+
+	depth := 0
+	for depth < len(chains[0])-1 && slices.IndexFunc(chains, func(chain []*Node) bool {
+		return depth >= len(chain)-1 || chain[depth] != chains[0][depth]
+	}) < 0 {
+		depth++
+	}
+	if depth == 0 {
+		return nil, nil
+	}
+	parent := chains[0][depth-1]
+
+	childSizes := make([]types.Size, len(parent.Nodes))
+	seen := make(map[int64]bool)
+	for i, chain := range chains {
+		child := chain[depth]
+		if seen[child.ID] {
+			log.Warn("Skipping sizes of the split of '%s': the tree does not match the configuration", group.marks[0])
+			return nil, nil
+		}
+		seen[child.ID] = true
+		childSizes[slices.Index(parent.Nodes, child)] = sizes[i]
+	}
+
+	return parent, childSizes
+}
+
+// Returns the tiled nodes from the root down to the node with the given ID,
+// or nil when it is not in the tiled layout
+func (n *Node) ancestors(id int64) []*Node {
+	if n.ID == id {
+		return []*Node{n}
+	}
+	for _, child := range n.Nodes {
+		if chain := child.ancestors(id); chain != nil {
+			return append([]*Node{n}, chain...)
+		}
+	}
+	return nil
+}
+
+// Computes the target size in pixels of each child of a split from their
+// configured sizes and the space they share
+//
+// Sizes in ppt are shares of that space and children without a size share
+// what is left equally. When sizes in px leave too little for them, or when
+// every child has a size but they do not fill the split, sizes are scaled to
+// fit. The sizes in pixels add up to the space of the split.
+func solveSizes(sizes []types.Size, total int) []int {
+	targets := make([]float64, len(sizes))
+	fixed := 0.0
+	unsized := 0
+
+	for i, size := range sizes {
+		switch {
+		case size.IsEmpty():
+			unsized++
+			continue
+		case size.Unit == types.UnitPixels:
+			targets[i] = float64(size.Value)
+		default:
+			targets[i] = float64(total) * float64(size.Value) / 100
+		}
+		fixed += targets[i]
+	}
+
+	space := float64(total)
+	remaining := space - fixed
+	scale := 1.0
+	switch minimum := space * minUnsizedShare / 100 * float64(unsized); {
+	case unsized == 0 && fixed > 0:
+		scale = space / fixed
+	case unsized > 0 && remaining < minimum && fixed > 0:
+		remaining = minimum
+		scale = (space - remaining) / fixed
+	}
+	for i := range targets {
+		targets[i] *= scale
+	}
+
+	// Rounding the running sum rather than each size keeps their total
+	result := make([]int, len(sizes))
+	sum, rounded := 0.0, 0
+	for i, size := range sizes {
+		if size.IsEmpty() {
+			targets[i] = remaining / float64(unsized)
+		}
+		sum += targets[i]
+		next := int(math.Round(sum))
+		result[i] = next - rounded
+		rounded = next
+	}
+	return result
+}
+
+// Grows or shrinks a tiled container by moving its right or bottom edge,
+// taking the space from, or giving it to, its next sibling
+func resizeContainer(ctx context.Context, conID int64, edge string, delta int, layout string) error {
+	action := "grow"
+	if delta < 0 {
+		action = "shrink"
+	}
+	amount := strconv.Itoa(abs(delta))
+
+	command := NewCommand("resize", action, edge, amount, "px").ForConID(conID)
+	if _, err := RunCommand(ctx, command.String()); err != nil {
+		return NewResizeError(fmt.Sprintf("con_id=%d", conID), amount+"px", action+" "+edge, layout,
+			fmt.Errorf("%w: %v", ErrResizeFailed, err))
+	}
+
+	return sleep(ctx, 100*time.Millisecond)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
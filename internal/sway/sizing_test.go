@@ -0,0 +1,414 @@
+package sway
+
+import (
+	"math/rand"
+	"reflect"
+	"slices"
+	"testing"
+	"testing/quick"
+
+	"github.com/titembaatar/sway.flem/internal/config"
+	"github.com/titembaatar/sway.flem/pkg/types"
+)
+
+// Parses sizes written as in the configuration
+func parseSizes(t *testing.T, sizes ...string) []types.Size {
+	t.Helper()
+
+	parsed := make([]types.Size, len(sizes))
+	for i, s := range sizes {
+		size, err := types.ParseSize(s)
+		if err != nil {
+			t.Fatalf("ParseSize(%q): %v", s, err)
+		}
+		parsed[i] = size
+	}
+	return parsed
+}
+
+func TestSolveSizes(t *testing.T) {
+	tests := []struct {
+		name  string
+		sizes []string
+		total int
+		want  []int
+	}{
+		{"none", nil, 1000, []int{}},
+		{"single unsized", []string{""}, 1000, []int{1000}},
+		{"ppt filling the split", []string{"50ppt", "50ppt"}, 1000, []int{500, 500}},
+		{"ppt without unit", []string{"25", "75"}, 1000, []int{250, 750}},
+		{"ppt and unsized", []string{"30ppt", "", ""}, 1000, []int{300, 350, 350}},
+		{"px, ppt and unsized", []string{"400px", "25ppt", ""}, 1600, []int{400, 400, 800}},
+		{"px and unsized", []string{"", "300px", ""}, 1000, []int{350, 300, 350}},
+
+		// Rounding
+		{"unsized thirds", []string{"", "", ""}, 1000, []int{333, 334, 333}},
+		{"ppt thirds", []string{"33ppt", "33ppt", "33ppt"}, 1000, []int{333, 334, 333}},
+		{"half pixels", []string{"50ppt", ""}, 1001, []int{501, 500}},
+		{"odd ppt", []string{"33ppt", "", ""}, 1001, []int{330, 336, 335}},
+
+		// Sizes not filling the split
+		{"ppt below 100", []string{"20ppt", "30ppt"}, 1000, []int{400, 600}},
+		{"px below the split", []string{"300px", "200px"}, 1000, []int{600, 400}},
+
+		// Over-constrained
+		{"px above the split", []string{"800px", "600px"}, 1000, []int{571, 429}},
+		{"px and ppt above the split", []string{"600px", "60ppt"}, 1000, []int{500, 500}},
+		{"px leaving no space", []string{"800px", "600px", ""}, 1000, []int{543, 407, 50}},
+		{"px leaving too little space", []string{"1200px", "", ""}, 1000, []int{900, 50, 50}},
+		{"ppt at 100 with unsized", []string{"100ppt", ""}, 1000, []int{950, 50}},
+		{"ppt above 100 with unsized", []string{"70ppt", "60ppt", ""}, 1000, []int{512, 438, 50}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := solveSizes(parseSizes(t, tt.sizes...), tt.total); !slices.Equal(got, tt.want) {
+				t.Errorf("solveSizes(%q, %d) = %v, want %v", tt.sizes, tt.total, got, tt.want)
+			}
+		})
+	}
+}
+
+// Sizes of the children of a split and the space they share
+type randomSplit struct {
+	Sizes []types.Size
+	Total int
+}
+
+func (randomSplit) Generate(r *rand.Rand, _ int) reflect.Value {
+	split := randomSplit{Total: 100 + r.Intn(4000)}
+	for range 1 + r.Intn(6) {
+		var size types.Size
+		switch r.Intn(3) {
+		case 0:
+			size = types.Size{Value: 1 + r.Intn(150), Unit: types.UnitPercent}
+		case 1:
+			size = types.Size{Value: 1 + r.Intn(3000), Unit: types.UnitPixels}
+		}
+		split.Sizes = append(split.Sizes, size)
+	}
+	return reflect.ValueOf(split)
+}
+
+// Whatever the sizes, the children fill the split without negative sizes
+func TestSolveSizesFillsSplit(t *testing.T) {
+	fills := func(split randomSplit) bool {
+		sum := 0
+		for _, size := range solveSizes(split.Sizes, split.Total) {
+			if size < 0 {
+				return false
+			}
+			sum += size
+		}
+		return sum == split.Total
+	}
+
+	if err := quick.Check(fills, &quick.Config{MaxCount: 5000}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPlanResizes(t *testing.T) {
+	tests := []struct {
+		name    string
+		current []int
+		targets []int
+		want    []resizeStep
+	}{
+		{"single child", []int{1000}, []int{1000}, nil},
+		{"at targets", []int{500, 500}, []int{500, 500}, nil},
+		{"within tolerance", []int{502, 298, 200}, []int{500, 300, 200}, nil},
+		{"grow", []int{200, 800}, []int{500, 500}, []resizeStep{{0, 300}}},
+		{"shrink", []int{800, 200}, []int{500, 500}, []resizeStep{{0, -300}}},
+		{"last only", []int{500, 300, 200}, []int{500, 100, 400}, []resizeStep{{1, -200}}},
+		{"cascade", []int{300, 300, 400}, []int{500, 300, 200}, []resizeStep{{0, 200}, {1, 200}}},
+		{"shrink then grow", []int{700, 100, 200}, []int{300, 300, 400}, []resizeStep{{0, -400}, {1, -200}}},
+		{"skipped within tolerance", []int{498, 202, 300}, []int{500, 400, 100}, []resizeStep{{1, 198}}},
+		{"beyond the next sibling", []int{100, 100, 800}, []int{400, 400, 200}, []resizeStep{{0, 300}, {1, 600}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current := slices.Clone(tt.current)
+			if got := planResizes(current, tt.targets); !slices.Equal(got, tt.want) {
+				t.Errorf("planResizes(%v, %v) = %v, want %v", tt.current, tt.targets, got, tt.want)
+			}
+			if !slices.Equal(current, tt.current) {
+				t.Errorf("planResizes changed the current sizes to %v", current)
+			}
+		})
+	}
+}
+
+// Applies resizes as sway does, moving the edge of a child towards its next
+// sibling, but no further than leaving minSize to either of them
+func applyResizes(sizes []int, steps []resizeStep, minSize int) []int {
+	sizes = slices.Clone(sizes)
+	for _, step := range steps {
+		delta := step.delta
+		if delta > 0 {
+			delta = min(delta, sizes[step.index+1]-minSize)
+		} else {
+			delta = max(delta, minSize-sizes[step.index])
+		}
+		sizes[step.index] += delta
+		sizes[step.index+1] -= delta
+	}
+	return sizes
+}
+
+// Runs at most maxPasses passes of resizes over a split, as ResizeWorkspace
+// does, and returns the sizes reached and the number of passes that resized
+// it
+func runResizePasses(current, targets []int, minSize, maxPasses int) ([]int, int) {
+	for pass := 0; ; pass++ {
+		steps := planResizes(current, targets)
+		if len(steps) == 0 || pass == maxPasses {
+			return current, pass
+		}
+		current = applyResizes(current, steps, minSize)
+	}
+}
+
+func TestResizePassesConverge(t *testing.T) {
+	tests := []struct {
+		name    string
+		current []int
+		targets []int
+		minSize int
+		passes  int
+	}{
+		{"at targets", []int{500, 500}, []int{500, 500}, 0, 0},
+		{"two children", []int{500, 500}, []int{300, 700}, 0, 1},
+		{"every child", []int{250, 250, 250, 250}, []int{100, 400, 200, 300}, 0, 1},
+		{"shrink cascade", []int{400, 400, 200}, []int{100, 100, 800}, 20, 1},
+		// Sway keeps a minimum size, so growing a child beyond its next
+		// sibling takes more passes
+		{"clamped by the next sibling", []int{100, 100, 800}, []int{400, 400, 200}, 0, 2},
+		{"clamped above the minimum size", []int{100, 100, 800}, []int{400, 400, 200}, 20, 2},
+		{"clamped cascade", []int{50, 50, 50, 850}, []int{300, 300, 300, 100}, 20, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reached, passes := runResizePasses(tt.current, tt.targets, tt.minSize, maxResizePasses)
+			if !slices.Equal(reached, tt.targets) {
+				t.Errorf("reached %v, want %v", reached, tt.targets)
+			}
+			if passes != tt.passes {
+				t.Errorf("settled after %d passes, want %d", passes, tt.passes)
+			}
+		})
+	}
+}
+
+// From any sizes, a split reaches the solved sizes within one pass less than
+// it has children, even when siblings are too small to give their space at
+// once, so maxResizePasses settles splits of up to five children
+func TestResizePassesSettle(t *testing.T) {
+	settles := func(split randomSplit, seed int64) bool {
+		r := rand.New(rand.NewSource(seed))
+		targets := solveSizes(split.Sizes, split.Total)
+
+		// Random current sizes sharing the same space
+		current := make([]int, len(targets))
+		left := split.Total
+		for i := range current[:len(current)-1] {
+			current[i] = r.Intn(left + 1)
+			left -= current[i]
+		}
+		current[len(current)-1] = left
+
+		reached, _ := runResizePasses(current, targets, 0, len(targets)-1)
+		if len(planResizes(reached, targets)) > 0 {
+			return false
+		}
+		last := len(targets) - 1
+		return abs(reached[last]-targets[last]) <= resizeTolerance*last
+	}
+
+	if err := quick.Check(settles, &quick.Config{MaxCount: 5000}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSizeGroups(t *testing.T) {
+	mark := func(m Mark) string { return m.String() }
+
+	tests := []struct {
+		name       string
+		containers []config.Container
+		want       [][]string // Marks and sizes of each group, alternating
+	}{
+		{
+			"no sizes",
+			[]config.Container{{App: "a"}, {App: "b"}},
+			nil,
+		},
+		{
+			"workspace and nested",
+			[]config.Container{
+				{App: "a", Size: "30ppt"},
+				{Split: types.LayoutVertical, Containers: []config.Container{{App: "b", Size: "60ppt"}, {App: "c"}}},
+				{App: "d", Size: "20ppt", Floating: true},
+				{ID: "term", App: "e", Size: "400px"},
+			},
+			[][]string{
+				{mark(NewAppMark("dev", nil, 0)), mark(NewContainerMark("dev", []int{1})), mark(NewIDMark("term"))},
+				{"30ppt", "", "400px"},
+				{mark(NewAppMark("dev", []int{1}, 0)), mark(NewAppMark("dev", []int{1}, 1))},
+				{"60ppt", ""},
+			},
+		},
+		{
+			"nested only",
+			[]config.Container{
+				{App: "a"},
+				{ID: "side", Split: types.LayoutVertical, Containers: []config.Container{
+					{App: "b"},
+					{Split: types.LayoutHorizontal, Containers: []config.Container{{App: "c"}, {App: "d", Size: "25ppt"}}},
+				}},
+			},
+			[][]string{
+				{mark(NewAppMark("dev", []int{1, 1}, 0)), mark(NewAppMark("dev", []int{1, 1}, 1))},
+				{"", "25ppt"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got [][]string
+			for _, group := range sizeGroups("dev", tt.containers, nil) {
+				var marks, sizes []string
+				for i := range group.marks {
+					marks = append(marks, group.marks[i].String())
+					sizes = append(sizes, group.sizes[i].String())
+				}
+				got = append(got, marks, sizes)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sizeGroups() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func window(id int64, marks ...string) *Node {
+	return &Node{ID: id, Type: "con", Marks: marks}
+}
+
+// Tree of a workspace 'dev' with an application, a nested container and an
+// application with an id, side by side, along with a floating application
+func sizingTree() (*Node, *Node, *Node) {
+	nested := &Node{ID: 11, Type: "con", Layout: "splitv", Nodes: []*Node{
+		// The mark of the nested container is carried by its first window
+		window(20, NewContainerMark("dev", []int{1}).String(), NewAppMark("dev", []int{1}, 0).String()),
+		window(21, NewAppMark("dev", []int{1}, 1).String()),
+	}}
+	workspace := &Node{ID: 3, Type: "workspace", Name: "dev", Layout: "splith",
+		Nodes: []*Node{
+			window(10, NewAppMark("dev", nil, 0).String()),
+			nested,
+			window(12, NewIDMark("term").String()),
+		},
+		FloatingNodes: []*Node{window(13, NewAppMark("dev", nil, 3).String())},
+	}
+	root := &Node{ID: 1, Type: "root", Nodes: []*Node{{ID: 2, Type: "output", Nodes: []*Node{workspace}}}}
+	return root, workspace, nested
+}
+
+func TestLocateGroup(t *testing.T) {
+	root, workspace, nested := sizingTree()
+	swapped, swappedWorkspace, _ := sizingTree()
+	nodes := swappedWorkspace.Nodes
+	nodes[0], nodes[2] = nodes[2], nodes[0]
+
+	topMarks := []Mark{NewAppMark("dev", nil, 0), NewContainerMark("dev", []int{1}), NewIDMark("term")}
+
+	tests := []struct {
+		name   string
+		tree   *Node
+		group  sizeGroup
+		parent *Node
+		sizes  []string
+	}{
+		{
+			"workspace",
+			root,
+			sizeGroup{marks: topMarks, sizes: parseSizes(t, "30ppt", "", "400px")},
+			workspace,
+			[]string{"30ppt", "", "400px"},
+		},
+		{
+			"nested container",
+			root,
+			sizeGroup{
+				marks: []Mark{NewAppMark("dev", []int{1}, 0), NewAppMark("dev", []int{1}, 1)},
+				sizes: parseSizes(t, "60ppt", ""),
+			},
+			nested,
+			[]string{"60ppt", ""},
+		},
+		{
+			"children moved in the tree",
+			swapped,
+			sizeGroup{marks: topMarks, sizes: parseSizes(t, "30ppt", "", "400px")},
+			swappedWorkspace,
+			[]string{"400px", "", "30ppt"},
+		},
+		{
+			"floating and missing containers",
+			root,
+			sizeGroup{
+				marks: []Mark{NewAppMark("dev", nil, 0), NewAppMark("dev", nil, 1), NewAppMark("dev", nil, 3), NewIDMark("term")},
+				sizes: parseSizes(t, "30ppt", "20ppt", "10ppt", "400px"),
+			},
+			workspace,
+			[]string{"30ppt", "", "400px"},
+		},
+		{
+			"single container in the tree",
+			root,
+			sizeGroup{
+				marks: []Mark{NewAppMark("dev", nil, 0), NewAppMark("dev", nil, 1)},
+				sizes: parseSizes(t, "30ppt", ""),
+			},
+			nil,
+			nil,
+		},
+		{
+			"tree not matching the configuration",
+			root,
+			sizeGroup{
+				marks: []Mark{NewAppMark("dev", []int{1}, 0), NewAppMark("dev", nil, 0), NewAppMark("dev", []int{1}, 1)},
+				sizes: parseSizes(t, "30ppt", "", ""),
+			},
+			nil,
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parent, sizes := locateGroup(tt.tree, tt.group)
+			if tt.sizes == nil {
+				if parent != nil {
+					t.Fatalf("locateGroup() = %d, want no split", parent.ID)
+				}
+				return
+			}
+			if parent != tt.parent {
+				t.Fatalf("locateGroup() = %v, want %d", parent, tt.parent.ID)
+			}
+
+			var got []string
+			for _, size := range sizes {
+				got = append(got, size.String())
+			}
+			if !slices.Equal(got, tt.sizes) {
+				t.Errorf("locateGroup() sizes = %q, want %q", got, tt.sizes)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package sway
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Sway command assembled from keywords, quoted arguments and criteria
+//
+// Sway splits commands on ';' and ',' and arguments on spaces outside quotes,
+// so values coming from the configuration or the tree, such as workspace
+// names and marks, are always quoted and never written as keywords.
+type Command struct {
+	criteria []string
+	words    []string
+}
+
+// Starts a command from keywords, written as they are
+func NewCommand(keywords ...string) *Command {
+	return &Command{words: keywords}
+}
+
+// Adds keywords, written as they are
+func (c *Command) Keyword(keywords ...string) *Command {
+	c.words = append(c.words, keywords...)
+	return c
+}
+
+// Adds a string argument, quoted
+func (c *Command) Arg(value string) *Command {
+	c.words = append(c.words, QuoteString(value))
+	return c
+}
+
+// Adds a workspace argument, as 'number <name>' for numbered workspaces so
+// that sway reuses a workspace with that number, whatever its name
+func (c *Command) Workspace(name string, number int) *Command {
+	if number > 0 {
+		c.Keyword("number")
+	}
+	return c.Arg(name)
+}
+
+// Restricts the command to the container with the given ID
+func (c *Command) ForConID(conID int64) *Command {
+	c.criteria = append(c.criteria, fmt.Sprintf("con_id=%d", conID))
+	return c
+}
+
+// Restricts the command to the container with exactly the given mark
+func (c *Command) ForMark(mark string) *Command {
+	return c.Match("con_mark", ExactRegex(mark))
+}
+
+// Restricts the command to containers whose property matches a regular
+// expression
+func (c *Command) Match(property, pattern string) *Command {
+	c.criteria = append(c.criteria, fmt.Sprintf("%s=%s", property, quoteCriteriaValue(pattern)))
+	return c
+}
+
+// Text of the command, as sent to sway
+func (c *Command) String() string {
+	command := strings.Join(c.words, " ")
+	if len(c.criteria) == 0 {
+		return command
+	}
+
+	criteria := "[" + strings.Join(c.criteria, " ") + "]"
+	if command == "" {
+		return criteria
+	}
+	return criteria + " " + command
+}
+
+// Quotes a string argument, escaping backslashes and double quotes
+func QuoteString(value string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(value); i++ {
+		if value[i] == '"' || value[i] == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(value[i])
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// Regular expression matching exactly the given text
+//
+// Sway matches every criteria value but con_id as a regular expression.
+func ExactRegex(value string) string {
+	return "^" + regexp.QuoteMeta(value) + "$"
+}
+
+// Quotes a criteria value; sway only unescapes double quotes in criteria,
+// leaving backslashes to the regular expression
+func quoteCriteriaValue(value string) string {
+	return `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+}
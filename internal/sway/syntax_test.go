@@ -0,0 +1,163 @@
+package sway
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestQuoteString(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"", `""`},
+		{"dev", `"dev"`},
+		{"1: web", `"1: web"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{`C:\dir`, `"C:\\dir"`},
+		{`\"`, `"\\\""`},
+		{"a;b,c", `"a;b,c"`},
+		{"[con_mark=x] kill", `"[con_mark=x] kill"`},
+		{"^a.b*$", `"^a.b*$"`},
+		{"日本語 😀", `"日本語 😀"`},
+		{"tab\there", "\"tab\there\""},
+	}
+
+	for _, tt := range tests {
+		if got := QuoteString(tt.value); got != tt.want {
+			t.Errorf("QuoteString(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+// Reads back a quoted argument as sway does, a backslash escaping the next
+// character
+func unquoteString(t *testing.T, quoted string) string {
+	t.Helper()
+	if len(quoted) < 2 || quoted[0] != '"' || quoted[len(quoted)-1] != '"' {
+		t.Fatalf("%s is not quoted", quoted)
+	}
+
+	var b strings.Builder
+	inner := quoted[1 : len(quoted)-1]
+	for i := 0; i < len(inner); i++ {
+		switch inner[i] {
+		case '\\':
+			i++
+			if i == len(inner) {
+				t.Fatalf("%s ends with an escaping backslash", quoted)
+			}
+		case '"':
+			t.Fatalf("%s has an unescaped quote", quoted)
+		}
+		b.WriteByte(inner[i])
+	}
+	return b.String()
+}
+
+func FuzzQuoteString(f *testing.F) {
+	for _, seed := range []string{"", "1: web", `say "hi"`, `C:\dir`, `\"`, "a;b,c", "日本語"} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, s string) {
+		if got := unquoteString(t, QuoteString(s)); got != s {
+			t.Fatalf("QuoteString(%q) reads back as %q", s, got)
+		}
+	})
+}
+
+func TestQuoteCriteriaValue(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"", `""`},
+		{"^firefox$", `"^firefox$"`},
+		{`a"b`, `"a\"b"`},
+		// Backslashes are left to the regular expression
+		{`^a\.b$`, `"^a\.b$"`},
+		{`\\`, `"\\"`},
+		{"a;b,c", `"a;b,c"`},
+		{"^日本語$", `"^日本語$"`},
+	}
+
+	for _, tt := range tests {
+		if got := quoteCriteriaValue(tt.value); got != tt.want {
+			t.Errorf("quoteCriteriaValue(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestExactRegex(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"", `^$`},
+		{"flem:app:1::0", `^flem:app:1::0$`},
+		{"flem:app:1:2.1:3", `^flem:app:1:2\.1:3$`},
+		{"a.b*c", `^a\.b\*c$`},
+		{"(x)[y]{z}|+?^$", `^\(x\)\[y\]\{z\}\|\+\?\^\$$`},
+		{`a\b`, `^a\\b$`},
+		{"1: web", `^1: web$`},
+		{"日本語", `^日本語$`},
+	}
+
+	for _, tt := range tests {
+		got := ExactRegex(tt.value)
+		if got != tt.want {
+			t.Errorf("ExactRegex(%q) = %s, want %s", tt.value, got, tt.want)
+			continue
+		}
+
+		re := regexp.MustCompile(got)
+		if !re.MatchString(tt.value) {
+			t.Errorf("%s does not match %q", got, tt.value)
+		}
+		for _, other := range []string{tt.value + "x", "x" + tt.value, tt.value + "\n"} {
+			if re.MatchString(other) {
+				t.Errorf("%s matches %q", got, other)
+			}
+		}
+	}
+}
+
+func TestCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		command *Command
+		want    string
+	}{
+		{"empty", NewCommand(), ""},
+		{"keywords", NewCommand("layout").Keyword("splith"), "layout splith"},
+		{"argument", NewCommand("exec").Arg(`echo \ "x"; exit`), `exec "echo \\ \"x\"; exit"`},
+		{"named workspace", NewCommand("workspace").Workspace("dev", 0), `workspace "dev"`},
+		{"numbered workspace", NewCommand("workspace").Workspace("1: web", 1), `workspace number "1: web"`},
+		{"workspace number only", NewCommand("workspace").Workspace("10", 10), `workspace number "10"`},
+		{
+			"workspace with separators",
+			NewCommand("move", "container", "to", "workspace").Workspace(`a;b, "c"`, 0),
+			`move container to workspace "a;b, \"c\""`,
+		},
+		{"con_id", NewCommand("mark", "--add").Arg("flem:term").ForConID(42), `[con_id=42] mark --add "flem:term"`},
+		{"mark", NewCommand("focus").ForMark("flem:app:1::0"), `[con_mark="^flem:app:1::0$"] focus`},
+		{"mark with metacharacters", NewCommand("focus").ForMark("flem:app:2:0.1:3"), `[con_mark="^flem:app:2:0\.1:3$"] focus`},
+		{"mark with quote", NewCommand().ForMark(`x"y`), `[con_mark="^x\"y$"]`},
+		{
+			"several criteria",
+			NewCommand("kill").Match("app_id", ExactRegex("org.gnome.Nautilus")).ForConID(3),
+			`[app_id="^org\.gnome\.Nautilus$" con_id=3] kill`,
+		},
+		{"mark command", NewIDMark("a b").Command("move", "scratchpad"), `[con_mark="^flem:a%20b$"] move scratchpad`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.command.String(); got != tt.want {
+				t.Errorf("String() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
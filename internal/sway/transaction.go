@@ -0,0 +1,98 @@
+package sway
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/titembaatar/sway.flem/internal/log"
+)
+
+// What to do when part of a workspace fails to set up
+type FailurePolicy string
+
+const (
+	FailureKeep     FailurePolicy = "keep"     // Log the error and keep going
+	FailureRollback FailurePolicy = "rollback" // Undo the failed workspace and continue with the others
+	FailureAbort    FailurePolicy = "abort"    // Stop the whole setup, leaving the workspace as is
+)
+
+// Time allowed to undo a workspace, even once the setup context is done
+const rollbackTimeout = 5 * time.Second
+
+// Parses a string into a FailurePolicy
+func ParseFailurePolicy(s string) (FailurePolicy, error) {
+	switch policy := FailurePolicy(strings.ToLower(strings.TrimSpace(s))); policy {
+	case FailureKeep, FailureRollback, FailureAbort:
+		return policy, nil
+	case "":
+		return FailureKeep, nil
+	default:
+		return "", fmt.Errorf("%w: '%s' (expected rollback, keep or abort)", ErrInvalidFailurePolicy, s)
+	}
+}
+
+// Tracks the changes flem made while setting up a workspace so they can be
+// undone if the workspace fails
+type Transaction struct {
+	Workspace string
+	launched  []string // Marks of the windows launched by flem
+	marked    []string // Marks applied by flem, including those of launched windows
+}
+
+func NewTransaction(workspace string) *Transaction {
+	return &Transaction{Workspace: workspace}
+}
+
+// Records a window launched by flem, identified by its mark
+func (t *Transaction) RecordLaunch(mark string) {
+	t.launched = append(t.launched, mark)
+	t.RecordMark(mark)
+}
+
+// Records a mark applied by flem
+func (t *Transaction) RecordMark(mark string) {
+	if !slices.Contains(t.marked, mark) {
+		t.marked = append(t.marked, mark)
+	}
+}
+
+// Removes the applied marks and closes the launched windows, most recent first
+//
+// The rollback runs on a context detached from the setup one, so a workspace
+// can still be undone after an interruption.
+func (t *Transaction) Rollback(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+	defer cancel()
+
+	log.Info("Rolling back workspace %s: %d windows, %d marks", t.Workspace, len(t.launched), len(t.marked))
+	var errors []string
+
+	// Killing a window drops all of its marks, so windows go first and only
+	// the marks left on pre-existing containers need removing afterwards
+	for _, mark := range slices.Backward(t.launched) {
+		if _, err := RunCommand(ctx, NewCommand("kill").ForMark(mark).String()); err != nil {
+			log.Warn("Failed to close window with mark '%s': %v", mark, err)
+			errors = append(errors, fmt.Sprintf("kill %s: %v", mark, err))
+		}
+	}
+
+	for _, mark := range slices.Backward(t.marked) {
+		if slices.Contains(t.launched, mark) {
+			continue
+		}
+		if _, err := RunCommand(ctx, NewCommand("unmark").Arg(mark).String()); err != nil {
+			log.Warn("Failed to remove mark '%s': %v", mark, err)
+			errors = append(errors, fmt.Sprintf("unmark %s: %v", mark, err))
+		}
+	}
+
+	if len(errors) > 0 {
+		return fmt.Errorf("%w: %s", ErrRollbackFailed, strings.Join(errors, "; "))
+	}
+
+	log.Info("Workspace %s rolled back", t.Workspace)
+	return nil
+}
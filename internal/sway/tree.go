@@ -0,0 +1,162 @@
+package sway
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/titembaatar/sway.flem/internal/log"
+)
+
+// Rectangle of a node, in pixels
+type Rect struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// X11 properties of Xwayland windows
+type WindowProperties struct {
+	Class    string `json:"class"`
+	Instance string `json:"instance"`
+	Title    string `json:"title"`
+}
+
+// Node of the sway layout tree, as returned by get_tree
+type Node struct {
+	ID               int64             `json:"id"`
+	Name             string            `json:"name"`
+	Type             string            `json:"type"`
+	Num              int               `json:"num"` // Number of a workspace, -1 when it has none
+	Layout           string            `json:"layout"`
+	Focused          bool              `json:"focused"`
+	Marks            []string          `json:"marks"`
+	Rect             Rect              `json:"rect"`
+	PID              int               `json:"pid"`
+	AppID            string            `json:"app_id"`
+	WindowProperties *WindowProperties `json:"window_properties,omitempty"`
+	Nodes            []*Node           `json:"nodes"`
+	FloatingNodes    []*Node           `json:"floating_nodes"`
+}
+
+// Interval between two polls of the tree while waiting for a window
+const windowPollInterval = 100 * time.Millisecond
+
+// Retrieves the layout tree from sway
+func GetTree(ctx context.Context) (*Node, error) {
+	var root Node
+	if err := executeSwayGetJSON(ctx, "", "get_tree", &root); err != nil {
+		return nil, err
+	}
+	return &root, nil
+}
+
+// Whether the node is an application window
+func (n *Node) IsWindow() bool {
+	if n.Type != "con" && n.Type != "floating_con" {
+		return false
+	}
+	return n.PID > 0 || n.AppID != "" || n.WindowProperties != nil
+}
+
+// Returns the first node, depth first, for which match returns true
+func (n *Node) Find(match func(*Node) bool) *Node {
+	if match(n) {
+		return n
+	}
+
+	for _, children := range [][]*Node{n.Nodes, n.FloatingNodes} {
+		for _, child := range children {
+			if found := child.Find(match); found != nil {
+				return found
+			}
+		}
+	}
+
+	return nil
+}
+
+// Returns the direct parent of the node with the given ID
+func (n *Node) FindParent(id int64) *Node {
+	return n.Find(func(candidate *Node) bool {
+		for _, children := range [][]*Node{candidate.Nodes, candidate.FloatingNodes} {
+			for _, child := range children {
+				if child.ID == id {
+					return true
+				}
+			}
+		}
+		return false
+	})
+}
+
+// Returns the node carrying the given mark
+func (n *Node) FindMark(mark string) *Node {
+	return n.Find(func(candidate *Node) bool {
+		for _, m := range candidate.Marks {
+			if m == mark {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// Returns the workspace holding the node with the given ID
+func (n *Node) FindWorkspace(id int64) *Node {
+	return n.Find(func(candidate *Node) bool {
+		return candidate.Type == "workspace" && candidate.Find(func(child *Node) bool {
+			return child.ID == id
+		}) != nil
+	})
+}
+
+// Returns the workspace with the given name, or with the given number for
+// numbered workspaces, as these are switched to by number
+func (n *Node) FindWorkspaceNamed(name string, number int) *Node {
+	return n.Find(func(candidate *Node) bool {
+		return candidate.Type == "workspace" && isWorkspace(candidate, name, number)
+	})
+}
+
+// Whether a workspace node is the workspace with the given name, or number
+func isWorkspace(workspace *Node, name string, number int) bool {
+	if number > 0 {
+		return workspace.Num == number
+	}
+	return workspace.Name == name
+}
+
+// Waits for a window accepted by match to appear in the tree
+func WaitForWindow(ctx context.Context, match func(*Node) bool, timeout time.Duration) (*Node, error) {
+	log.Debug("Waiting up to %s for a window", timeout)
+
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for waitCtx.Err() == nil {
+		tree, err := GetTree(waitCtx)
+		if err != nil {
+			if waitCtx.Err() != nil {
+				break
+			}
+			return nil, err
+		}
+
+		window := tree.Find(func(n *Node) bool {
+			return n.IsWindow() && match(n)
+		})
+		if window != nil {
+			log.Debug("Found window %d (app_id '%s', pid %d)", window.ID, window.AppID, window.PID)
+			return window, nil
+		}
+
+		_ = sleep(waitCtx, windowPollInterval)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("%w: no matching window after %s", ErrWindowTimeout, timeout)
+}
@@ -0,0 +1,150 @@
+package sway
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/titembaatar/sway.flem/internal/config"
+	"github.com/titembaatar/sway.flem/pkg/types"
+)
+
+// Variant selected for a workspace, and why
+type VariantChoice struct {
+	Workspace string
+	Index     int      // Index of the variant, -1 for the workspace definition
+	Reasons   []string // Why each variant was rejected or selected, in order
+}
+
+// Selects the variant of each workspace with variants from the outputs
+//
+// The first variant whose condition holds is used; when none does, the
+// workspace keeps its own definition.
+func SelectVariants(cfg *config.Config, outputs []Output) []VariantChoice {
+	var choices []VariantChoice
+
+	for _, name := range WorkspaceOrder(cfg) {
+		workspace := cfg.Workspaces[name]
+		if len(workspace.Variants) == 0 {
+			continue
+		}
+
+		choice := VariantChoice{Workspace: name, Index: -1}
+		for i, variant := range workspace.Variants {
+			matched, reason := EvaluateCondition(variant.When, outputs)
+			if matched {
+				choice.Index = i
+				choice.Reasons = append(choice.Reasons, fmt.Sprintf("variant %d selected: %s", i+1, reason))
+				break
+			}
+			choice.Reasons = append(choice.Reasons, fmt.Sprintf("variant %d skipped: %s", i+1, reason))
+		}
+		if choice.Index < 0 {
+			choice.Reasons = append(choice.Reasons, "no variant matched, using the workspace definition")
+		}
+
+		choices = append(choices, choice)
+	}
+
+	return choices
+}
+
+// Selected variant indexes by workspace, as used by config.ApplyVariants
+func VariantIndexes(choices []VariantChoice) map[string]int {
+	indexes := make(map[string]int, len(choices))
+	for _, choice := range choices {
+		indexes[choice.Workspace] = choice.Index
+	}
+	return indexes
+}
+
+// Whether a condition holds for the active outputs, with a short explanation
+func EvaluateCondition(condition config.Condition, outputs []Output) (bool, string) {
+	var active []Output
+	for _, output := range outputs {
+		if output.Active {
+			active = append(active, output)
+		}
+	}
+
+	if condition.IsEmpty() {
+		return true, "no condition"
+	}
+
+	var reasons []string
+
+	// Conditions are checked by the config validator
+	if count, _ := types.ParseComparison(condition.Outputs); !count.IsEmpty() {
+		if !count.Matches(float64(len(active))) {
+			return false, fmt.Sprintf("%d outputs, expected %s", len(active), count)
+		}
+		reasons = append(reasons, fmt.Sprintf("%d outputs %s", len(active), count))
+	}
+
+	if !condition.HasOutputCriteria() {
+		return true, strings.Join(reasons, ", ")
+	}
+
+	candidates := active
+	if condition.Output != "" {
+		candidates = nil
+		for _, output := range active {
+			if output.Name == condition.Output {
+				candidates = append(candidates, output)
+			}
+		}
+		if len(candidates) == 0 {
+			return false, fmt.Sprintf("output %s is not connected", condition.Output)
+		}
+	}
+
+	var mismatches []string
+	for _, output := range candidates {
+		mismatch := outputMismatch(condition, output)
+		if mismatch == "" {
+			reasons = append(reasons, fmt.Sprintf("%s is %s %s at scale %s",
+				output.Name, output.Resolution(), output.Orientation(), formatScale(output.Scale)))
+			return true, strings.Join(reasons, ", ")
+		}
+		mismatches = append(mismatches, fmt.Sprintf("%s %s", output.Name, mismatch))
+	}
+
+	if len(mismatches) == 0 {
+		return false, "no output connected"
+	}
+	return false, strings.Join(mismatches, ", ")
+}
+
+// Describes the first criterion of the condition the output fails, or returns
+// an empty string when it satisfies all of them
+func outputMismatch(condition config.Condition, output Output) string {
+	if condition.Resolution != "" && output.Resolution() != condition.Resolution {
+		return fmt.Sprintf("is %s, expected %s", output.Resolution(), condition.Resolution)
+	}
+
+	comparisons := []struct {
+		name  string
+		spec  string
+		value float64
+		shown string
+	}{
+		{"width", condition.Width, float64(output.CurrentMode.Width), fmt.Sprint(output.CurrentMode.Width)},
+		{"height", condition.Height, float64(output.CurrentMode.Height), fmt.Sprint(output.CurrentMode.Height)},
+		{"scale", condition.Scale, output.Scale, formatScale(output.Scale)},
+	}
+	for _, c := range comparisons {
+		comparison, _ := types.ParseComparison(c.spec)
+		if !comparison.IsEmpty() && !comparison.Matches(c.value) {
+			return fmt.Sprintf("has %s %s, expected %s", c.name, c.shown, comparison)
+		}
+	}
+
+	if condition.Orientation != "" && output.Orientation() != condition.Orientation {
+		return fmt.Sprintf("is %s, expected %s", output.Orientation(), condition.Orientation)
+	}
+
+	return ""
+}
+
+func formatScale(scale float64) string {
+	return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.2f", scale), "0"), ".")
+}
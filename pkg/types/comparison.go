@@ -0,0 +1,95 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Comparison errors
+var (
+	ErrInvalidComparison = errors.New("invalid comparison: must be a number, optionally preceded by '=', '!=', '<', '<=', '>' or '>='")
+)
+
+// Comparison operator
+type CompareOp string
+
+// Comparison operators
+const (
+	CompareEqual        CompareOp = "="
+	CompareNotEqual     CompareOp = "!="
+	CompareLess         CompareOp = "<"
+	CompareLessEqual    CompareOp = "<="
+	CompareGreater      CompareOp = ">"
+	CompareGreaterEqual CompareOp = ">="
+)
+
+// Operators, longest first so that prefixes match correctly
+var compareOps = []CompareOp{
+	CompareNotEqual, CompareLessEqual, CompareGreaterEqual,
+	CompareLess, CompareGreater, CompareEqual,
+}
+
+// Numeric condition, such as '>=2'
+type Comparison struct {
+	Op    CompareOp
+	Value float64
+}
+
+// String into a Comparison, where a plain number means equality
+func ParseComparison(s string) (Comparison, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Comparison{}, nil
+	}
+
+	op := CompareEqual
+	for _, candidate := range compareOps {
+		if rest, found := strings.CutPrefix(s, string(candidate)); found {
+			op, s = candidate, strings.TrimSpace(rest)
+			break
+		}
+	}
+	// '==' reads naturally as well
+	if op == CompareEqual {
+		s = strings.TrimPrefix(s, "=")
+	}
+
+	value, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return Comparison{}, ErrInvalidComparison
+	}
+
+	return Comparison{Op: op, Value: value}, nil
+}
+
+// Whether the value satisfies the comparison
+func (c Comparison) Matches(v float64) bool {
+	switch c.Op {
+	case CompareNotEqual:
+		return v != c.Value
+	case CompareLess:
+		return v < c.Value
+	case CompareLessEqual:
+		return v <= c.Value
+	case CompareGreater:
+		return v > c.Value
+	case CompareGreaterEqual:
+		return v >= c.Value
+	default:
+		return v == c.Value
+	}
+}
+
+// String representation of the comparison
+func (c Comparison) String() string {
+	if c.IsEmpty() {
+		return ""
+	}
+	return fmt.Sprintf("%s%s", c.Op, strconv.FormatFloat(c.Value, 'f', -1, 64))
+}
+
+func (c Comparison) IsEmpty() bool {
+	return c.Op == ""
+}
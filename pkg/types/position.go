@@ -0,0 +1,143 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Position errors
+var (
+	ErrInvalidPosition = errors.New("invalid position: must be 'center', '<x> <y>' or an anchor ('top-left', 'bottom', ...) optionally followed by a margin")
+)
+
+// How a floating window is positioned
+type PositionKind string
+
+// Position kinds
+const (
+	PositionAbsolute PositionKind = "absolute" // At coordinates from the top-left corner of the output
+	PositionCenter   PositionKind = "center"   // Centered on the output
+	PositionAnchor   PositionKind = "anchor"   // Against one or two edges of the output
+)
+
+// Edge or corner of the output a floating window is placed against
+type Anchor string
+
+// Anchors
+const (
+	AnchorTop         Anchor = "top"
+	AnchorBottom      Anchor = "bottom"
+	AnchorLeft        Anchor = "left"
+	AnchorRight       Anchor = "right"
+	AnchorTopLeft     Anchor = "top-left"
+	AnchorTopRight    Anchor = "top-right"
+	AnchorBottomLeft  Anchor = "bottom-left"
+	AnchorBottomRight Anchor = "bottom-right"
+)
+
+var anchors = map[Anchor]bool{
+	AnchorTop: true, AnchorBottom: true, AnchorLeft: true, AnchorRight: true,
+	AnchorTopLeft: true, AnchorTopRight: true, AnchorBottomLeft: true, AnchorBottomRight: true,
+}
+
+// Position of a floating window
+type Position struct {
+	Kind   PositionKind
+	X, Y   Size   // Coordinates of absolute positions
+	Anchor Anchor // Anchor of anchored positions
+	Margin Size   // Distance kept from the anchor edges
+}
+
+// String into a Position
+func ParsePosition(s string) (Position, error) {
+	fields := strings.Fields(strings.ToLower(s))
+
+	switch {
+	case len(fields) == 0:
+		return Position{}, nil
+
+	case len(fields) == 1 && fields[0] == string(PositionCenter):
+		return Position{Kind: PositionCenter}, nil
+
+	case anchors[Anchor(fields[0])] && len(fields) <= 2:
+		position := Position{Kind: PositionAnchor, Anchor: Anchor(fields[0])}
+		if len(fields) == 2 {
+			margin, err := ParseSize(fields[1])
+			if err != nil {
+				return Position{}, ErrInvalidPosition
+			}
+			position.Margin = margin
+		}
+		return position, nil
+
+	case len(fields) == 2:
+		x, errX := ParseSize(fields[0])
+		y, errY := ParseSize(fields[1])
+		if errX != nil || errY != nil {
+			return Position{}, ErrInvalidPosition
+		}
+		return Position{Kind: PositionAbsolute, X: x, Y: y}, nil
+
+	default:
+		return Position{}, ErrInvalidPosition
+	}
+}
+
+// String representation of the position
+func (p Position) String() string {
+	switch p.Kind {
+	case PositionCenter:
+		return string(PositionCenter)
+	case PositionAnchor:
+		if p.Margin.IsEmpty() {
+			return string(p.Anchor)
+		}
+		return fmt.Sprintf("%s %s", p.Anchor, p.Margin)
+	case PositionAbsolute:
+		return fmt.Sprintf("%s %s", sizeOrZero(p.X), sizeOrZero(p.Y))
+	default:
+		return ""
+	}
+}
+
+// Coordinate as a string, where an empty size is 0
+func sizeOrZero(s Size) string {
+	if s.IsEmpty() {
+		return "0"
+	}
+	return s.String()
+}
+
+// Whether the window touches the top, bottom, left or right edge
+func (a Anchor) Edges() (top, bottom, left, right bool) {
+	name := string(a)
+	return strings.HasPrefix(name, "top"), strings.HasPrefix(name, "bottom"),
+		strings.HasSuffix(name, "left"), strings.HasSuffix(name, "right")
+}
+
+func (p Position) IsEmpty() bool {
+	return p.Kind == ""
+}
+
+// json.Marshaler interface
+func (p Position) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.String())
+}
+
+// json.Unmarshaler interface
+func (p *Position) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return err
+	}
+
+	position, err := ParsePosition(str)
+	if err != nil {
+		return err
+	}
+
+	*p = position
+	return nil
+}
@@ -0,0 +1,131 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Post action errors
+var (
+	ErrInvalidPostAction = errors.New("invalid post action: must be 'sway: <command>', 'sway@<id>: <command>', 'exec: <command>' or 'wait: <duration>'")
+	ErrEmptyPostAction   = errors.New("post action has no command")
+	ErrInvalidWait       = errors.New("invalid wait duration: must be a positive duration (e.g. '500ms', '2s') or a number of seconds")
+	ErrEmptyPostTarget   = errors.New("post action has no target container id after '@'")
+)
+
+// Kind of action run after an application is launched
+type PostActionKind string
+
+// Post action kinds
+const (
+	PostSway PostActionKind = "sway" // Sway command run against the application window, or another container
+	PostExec PostActionKind = "exec" // Process started with the window details in its environment
+	PostWait PostActionKind = "wait" // Pause before the next action
+)
+
+// Action run after an application is launched
+type PostAction struct {
+	Kind    PostActionKind
+	Command string        // Command for sway and exec actions
+	Target  string        // Id of the container sway actions run against, the application when empty
+	Wait    time.Duration // Duration for wait actions
+}
+
+// Parses a post action entry
+//
+// Entries without a known prefix are exec actions, as post commands used to be.
+// Sway actions written 'sway@<id>: <command>' run against the container with
+// the given id.
+func ParsePostAction(s string) (PostAction, error) {
+	s = strings.TrimSpace(s)
+
+	kind, value, target := PostExec, s, ""
+	if prefix, rest, found := strings.Cut(s, ":"); found {
+		name, id, hasTarget := strings.Cut(strings.TrimSpace(prefix), "@")
+		if hasTarget {
+			switch PostActionKind(strings.ToLower(name)) {
+			case PostSway:
+				if target = strings.TrimSpace(id); target == "" {
+					return PostAction{}, ErrEmptyPostTarget
+				}
+			case PostExec, PostWait:
+				return PostAction{}, ErrInvalidPostAction
+			}
+		}
+
+		switch PostActionKind(strings.ToLower(name)) {
+		case PostSway:
+			kind, value = PostSway, strings.TrimSpace(rest)
+		case PostExec:
+			kind, value = PostExec, strings.TrimSpace(rest)
+		case PostWait:
+			kind, value = PostWait, strings.TrimSpace(rest)
+		}
+	}
+
+	if kind == PostWait {
+		wait, err := parseWait(value)
+		if err != nil {
+			return PostAction{}, err
+		}
+		return PostAction{Kind: kind, Wait: wait}, nil
+	}
+
+	if value == "" {
+		return PostAction{}, ErrEmptyPostAction
+	}
+
+	return PostAction{Kind: kind, Command: value, Target: target}, nil
+}
+
+// Parses a wait duration, given as a Go duration or a number of seconds
+func parseWait(s string) (time.Duration, error) {
+	if seconds, err := strconv.ParseFloat(s, 64); err == nil {
+		if seconds <= 0 {
+			return 0, ErrInvalidWait
+		}
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+
+	wait, err := time.ParseDuration(s)
+	if err != nil || wait <= 0 {
+		return 0, ErrInvalidWait
+	}
+	return wait, nil
+}
+
+// String representation of the post action
+func (p PostAction) String() string {
+	if p.Kind == PostWait {
+		return fmt.Sprintf("%s: %s", p.Kind, p.Wait)
+	}
+	if p.Target != "" {
+		return fmt.Sprintf("%s@%s: %s", p.Kind, p.Target, p.Command)
+	}
+	return fmt.Sprintf("%s: %s", p.Kind, p.Command)
+}
+
+// json.Marshaler interface
+func (p PostAction) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.String())
+}
+
+// json.Unmarshaler interface
+func (p *PostAction) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	action, err := ParsePostAction(s)
+	if err != nil {
+		return err
+	}
+
+	*p = action
+	return nil
+}